@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/db/sessiondb"
+)
+
+const banUsage = `usage: atlas [options] ban add -reason text [-expires duration|time] uid|ip[/bits]|ip:port
+       atlas [options] ban list [-all]
+       atlas [options] ban rm id...
+`
+
+// banMain runs the ban admin commands.
+func banMain(c config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, banUsage)
+		return 2
+	}
+
+	db, err := sessiondb.Open(filepath.Join(c.DataDir, "session.db"), c.sqliteOptions())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: sessiondb: open: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if cur, to, err := db.Version(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: sessiondb: get version: %v\n", err)
+		return 1
+	} else if cur != to {
+		fmt.Fprintf(os.Stderr, "error: sessiondb: database version %d does not match %d (run atlas migrate up)\n", cur, to)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "add":
+		fs := flag.NewFlagSet("ban add", flag.ContinueOnError)
+		reason := fs.String("reason", "", "reason shown to the client (required)")
+		expires := fs.String("expires", "", "ban duration (e.g., 72h) or RFC3339 expiry time (default: permanent)")
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() != 1 || *reason == "" {
+			fmt.Fprint(os.Stderr, banUsage)
+			return 2
+		}
+
+		b, err := parseBanTarget(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 2
+		}
+		b.Reason = *reason
+
+		if *expires != "" {
+			if d, err := time.ParseDuration(*expires); err == nil && d > 0 {
+				b.Expires = time.Now().Add(d)
+			} else if t, err := time.Parse(time.RFC3339, *expires); err == nil {
+				b.Expires = t
+			} else {
+				fmt.Fprintf(os.Stderr, "error: invalid expiry %q\n", *expires)
+				return 2
+			}
+		}
+
+		if b, err = db.AddBan(ctx, b); err != nil {
+			fmt.Fprintf(os.Stderr, "error: add ban: %v\n", err)
+			return 1
+		}
+		printBans([]sessiondb.Ban{b})
+
+	case "list":
+		fs := flag.NewFlagSet("ban list", flag.ContinueOnError)
+		all := fs.Bool("all", false, "include expired bans")
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() != 0 {
+			fmt.Fprint(os.Stderr, banUsage)
+			return 2
+		}
+
+		bans, err := db.GetBans(ctx, *all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: get bans: %v\n", err)
+			return 1
+		}
+		printBans(bans)
+
+	case "rm":
+		if len(args) == 0 {
+			fmt.Fprint(os.Stderr, banUsage)
+			return 2
+		}
+		var failed bool
+		for _, x := range args {
+			id, err := strconv.ParseInt(x, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: invalid ban id %q\n", x)
+				failed = true
+				continue
+			}
+			if ok, err := db.DeleteBan(ctx, id); err != nil {
+				fmt.Fprintf(os.Stderr, "error: delete ban %d: %v\n", id, err)
+				failed = true
+			} else if !ok {
+				fmt.Fprintf(os.Stderr, "error: ban %d does not exist\n", id)
+				failed = true
+			}
+		}
+		if failed {
+			return 1
+		}
+
+	default:
+		fmt.Fprint(os.Stderr, banUsage)
+		return 2
+	}
+	return 0
+}
+
+// parseBanTarget parses a player uid, ip address or prefix, or server
+// address.
+func parseBanTarget(s string) (sessiondb.Ban, error) {
+	var b sessiondb.Ban
+	if uid, err := strconv.ParseUint(s, 10, 64); err == nil && uid != 0 {
+		b.UID = uid
+	} else if p, err := netip.ParsePrefix(s); err == nil {
+		b.IP = p
+	} else if a, err := netip.ParseAddrPort(s); err == nil {
+		b.Server = a
+	} else if a, err := netip.ParseAddr(s); err == nil {
+		b.IP = netip.PrefixFrom(a, a.BitLen())
+	} else {
+		return b, fmt.Errorf("invalid ban target %q (expected a uid, ip, ip prefix, or ip:port)", s)
+	}
+	return b, nil
+}
+
+// printBans prints a table of bans to stdout.
+func printBans(bans []sessiondb.Ban) {
+	now := time.Now()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTARGET\tCREATED\tEXPIRES\tREASON")
+	for _, b := range bans {
+		var target string
+		switch {
+		case b.UID != 0:
+			target = "uid " + strconv.FormatUint(b.UID, 10)
+		case b.IP.IsValid():
+			target = "ip " + b.IP.String()
+		case b.Server.IsValid():
+			target = "server " + b.Server.String()
+		}
+		expires := "never"
+		if !b.Expires.IsZero() {
+			expires = b.Expires.Format(time.RFC3339)
+			if b.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", b.ID, target, b.Created.Format(time.RFC3339), expires, strings.ReplaceAll(b.Reason, "\n", " "))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/db/sqlite"
+)
+
+const usage = `usage: atlas [options]
+       atlas [options] ban ...
+       atlas [options] migrate ...
+
+options can also be set with ATLAS_* environment variables (e.g., -udp-addr is
+ATLAS_UDP_ADDR), or in a config file containing ATLAS_NAME=value lines. flags
+take precedence over environment variables, which take precedence over the
+config file.
+
+options:
+`
+
+// errUsage is returned by loadConfig if the flags are invalid. The error and
+// usage have already been printed.
+var errUsage = errors.New("invalid usage")
+
+// config contains the configuration for atlas.
+type config struct {
+	Addr    string // http listen address
+	UDPAddr string // udp listen address, empty to disable
+	DataDir string
+
+	AutoMigrate bool
+
+	SQLiteBusyTimeout time.Duration
+	SQLiteCacheSize   int
+	SQLiteSynchronous string
+
+	SessionTTL    time.Duration
+	PlayerAuthTTL time.Duration
+	ServerAuthTTL time.Duration
+	ServerTTL     time.Duration
+	PdataLockTTL  time.Duration
+
+	PlayerAuth     string // origin or fake
+	IP2Location    string
+	MainMenuPromos string
+	AdminToken     string
+
+	ShutdownTimeout time.Duration
+}
+
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", ":8080", "http listen address")
+	fs.StringVar(&c.UDPAddr, "udp-addr", ":8080", "udp listen address for server verification and connect packets (empty to disable)")
+	fs.StringVar(&c.DataDir, "data-dir", "data", "directory containing the databases")
+	fs.BoolVar(&c.AutoMigrate, "auto-migrate", true, "migrate the databases up on startup (disable to back them up and run atlas migrate up manually)")
+	fs.DurationVar(&c.SQLiteBusyTimeout, "sqlite-busy-timeout", 0, "sqlite busy timeout (default: 6s for pdata, 3s for sessions)")
+	fs.IntVar(&c.SQLiteCacheSize, "sqlite-cache-size", 0, "sqlite page cache size in KiB (default: 16000)")
+	fs.StringVar(&c.SQLiteSynchronous, "sqlite-synchronous", "", "sqlite synchronous mode: OFF, NORMAL, FULL, or EXTRA (default: NORMAL)")
+	fs.DurationVar(&c.SessionTTL, "session-ttl", 0, "how long unused sessions last (default: 24h, negative for never)")
+	fs.DurationVar(&c.PlayerAuthTTL, "player-auth-ttl", 0, "how long player authentication lasts (default: 12h, negative for never)")
+	fs.DurationVar(&c.ServerAuthTTL, "server-auth-ttl", 0, "how long server verification lasts (default: 1h, negative for never)")
+	fs.DurationVar(&c.ServerTTL, "server-ttl", 0, "how long servers last without a heartbeat (default: 45s, negative for never)")
+	fs.DurationVar(&c.PdataLockTTL, "pdata-lock-ttl", 0, "how long pdata locks last without being renewed (default: 12h, negative for never)")
+	fs.StringVar(&c.PlayerAuth, "player-auth", "origin", "player authentication: origin, or fake to accept any token as the username (for offline testing only)")
+	fs.StringVar(&c.IP2Location, "ip2location", "", "path to an ip2location database for server regions")
+	fs.StringVar(&c.MainMenuPromos, "mainmenupromos", "", "path to the main menu promos json file (default: DATA_DIR/mainmenupromos.json)")
+	fs.StringVar(&c.AdminToken, "admin-token", "", "bearer token required for /metrics (if empty, it is public)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "how long to wait for requests to finish when shutting down")
+}
+
+// envName gets the environment variable name for a flag.
+func envName(flag string) string {
+	return "ATLAS_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// loadConfig loads the config from flags, the environment, and the config
+// file, returning the remaining arguments.
+func loadConfig(args []string) (config, []string, error) {
+	var c config
+
+	fs := flag.NewFlagSet("atlas", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", "", "path to a config file")
+	c.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return c, nil, err
+		}
+		return c, nil, errUsage
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if v, ok := os.LookupEnv(envName("config")); ok && !set["config"] {
+		*configFile = v
+	}
+
+	var file map[string]string
+	if *configFile != "" {
+		var err error
+		if file, err = readConfigFile(*configFile); err != nil {
+			return c, nil, fmt.Errorf("config file: %w", err)
+		}
+		known := map[string]bool{}
+		fs.VisitAll(func(f *flag.Flag) {
+			known[envName(f.Name)] = f.Name != "config"
+		})
+		for name := range file {
+			if !known[name] {
+				return c, nil, fmt.Errorf("config file: %s: unknown option %s", *configFile, name)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "config" {
+			return
+		}
+		name := envName(f.Name)
+		if v, ok := os.LookupEnv(name); ok {
+			if e := f.Value.Set(v); e != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", v, name, e)
+			}
+		} else if v, ok := file[name]; ok {
+			if e := f.Value.Set(v); e != nil {
+				err = fmt.Errorf("config file: %s: invalid value %q for %s: %w", *configFile, v, name, e)
+			}
+		}
+	})
+	if err != nil {
+		return c, nil, err
+	}
+
+	if err := c.validate(); err != nil {
+		return c, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// readConfigFile reads a file containing NAME=value lines. Blank lines and
+// lines starting with # are ignored, and values may be quoted.
+func readConfigFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", name, n)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		if _, dup := m[k]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate option %s", name, n, k)
+		}
+		m[k] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// validate checks c and fills in derived defaults.
+func (c *config) validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("invalid listen address (addr) %q: %w", c.Addr, err))
+	}
+	if c.UDPAddr != "" {
+		if _, err := net.ResolveUDPAddr("udp", c.UDPAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid udp listen address (udp-addr) %q: %w", c.UDPAddr, err))
+		}
+	}
+	if c.DataDir == "" {
+		errs = append(errs, fmt.Errorf("data directory (data-dir) must not be empty"))
+	}
+	if err := c.sqliteOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.PlayerAuth {
+	case "origin", "fake":
+	default:
+		errs = append(errs, fmt.Errorf("player authentication (player-auth) %q must be origin or fake", c.PlayerAuth))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout (shutdown-timeout) must be positive"))
+	}
+	if c.IP2Location != "" {
+		if _, err := os.Stat(c.IP2Location); err != nil {
+			errs = append(errs, fmt.Errorf("ip2location database (ip2location): %w", err))
+		}
+	}
+	if c.MainMenuPromos == "" && c.DataDir != "" {
+		c.MainMenuPromos = filepath.Join(c.DataDir, "mainmenupromos.json")
+	}
+	return errors.Join(errs...)
+}
+
+func (c config) sqliteOptions() sqlite.Options {
+	return sqlite.Options{
+		BusyTimeout: c.SQLiteBusyTimeout,
+		CacheSize:   c.SQLiteCacheSize,
+		Synchronous: c.SQLiteSynchronous,
+	}
+}
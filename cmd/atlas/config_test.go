@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "atlas.conf")
+	if err := os.WriteFile(file, []byte(strings.Join([]string{
+		"# comment",
+		"",
+		"ATLAS_ADDR=:1001",
+		"ATLAS_UDP_ADDR=:1002",
+		`ATLAS_DATA_DIR="file"`,
+		"ATLAS_SERVER_TTL = 1m",
+	}, "\n")), 0666); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	t.Setenv("ATLAS_CONFIG", file)
+	t.Setenv("ATLAS_ADDR", ":2001")
+	t.Setenv("ATLAS_UDP_ADDR", ":2002")
+
+	c, args, err := loadConfig([]string{"-addr", ":3001", "migrate", "status"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if c.Addr != ":3001" {
+		t.Errorf("expected the flag to override the environment, got addr %q", c.Addr)
+	}
+	if c.UDPAddr != ":2002" {
+		t.Errorf("expected the environment to override the config file, got udp addr %q", c.UDPAddr)
+	}
+	if c.DataDir != "file" {
+		t.Errorf("expected the quoted config file value, got data dir %q", c.DataDir)
+	}
+	if c.ServerTTL != time.Minute {
+		t.Errorf("expected the config file value, got server ttl %s", c.ServerTTL)
+	}
+	if c.ShutdownTimeout != 15*time.Second {
+		t.Errorf("expected the default, got shutdown timeout %s", c.ShutdownTimeout)
+	}
+	if c.MainMenuPromos != filepath.Join("file", "mainmenupromos.json") {
+		t.Errorf("expected the derived default, got main menu promos %q", c.MainMenuPromos)
+	}
+	if len(args) != 2 || args[0] != "migrate" || args[1] != "status" {
+		t.Errorf("expected the remaining arguments, got %q", args)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Lines []string
+		Error string
+	}{
+		{Name: "UnknownOption", Lines: []string{"ATLAS_ADDRESS=:8080"}, Error: "unknown option ATLAS_ADDRESS"},
+		{Name: "ConfigOption", Lines: []string{"ATLAS_CONFIG=other.conf"}, Error: "unknown option ATLAS_CONFIG"},
+		{Name: "Duplicate", Lines: []string{"ATLAS_ADDR=:1", "ATLAS_ADDR=:2"}, Error: "duplicate option ATLAS_ADDR"},
+		{Name: "Syntax", Lines: []string{"ATLAS_ADDR"}, Error: "expected NAME=value"},
+		{Name: "InvalidValue", Lines: []string{"ATLAS_SERVER_TTL=soon"}, Error: "invalid value"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "atlas.conf")
+			if err := os.WriteFile(file, []byte(strings.Join(tc.Lines, "\n")), 0666); err != nil {
+				t.Fatalf("write config file: %v", err)
+			}
+			if _, _, err := loadConfig([]string{"-config", file}); err == nil {
+				t.Errorf("expected error")
+			} else if !strings.Contains(err.Error(), tc.Error) {
+				t.Errorf("expected error containing %q, got %v", tc.Error, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	t.Setenv("ATLAS_SQLITE_SYNCHRONOUS", "sometimes")
+
+	_, _, err := loadConfig([]string{"-addr", "nope", "-player-auth", "none", "-shutdown-timeout", "0s"})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, x := range []string{"addr", "player-auth", "shutdown-timeout", "sqlite synchronous mode"} {
+		if !strings.Contains(err.Error(), x) {
+			t.Errorf("expected error to mention %s, got %v", x, err)
+		}
+	}
+}
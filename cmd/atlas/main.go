@@ -3,58 +3,196 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/r2northstar/atlas/v2/db/pdatadb"
 	"github.com/r2northstar/atlas/v2/db/sessiondb"
 	"github.com/r2northstar/atlas/v2/pkg/atlas"
+	"github.com/r2northstar/atlas/v2/pkg/nspkt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	if err := os.Mkdir("data", 0777); err != nil && !errors.Is(err, os.ErrExist) {
-		panic(err)
+	c, args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if !errors.Is(err, errUsage) {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(os.Stderr, "error: %s\n", line)
+			}
+		}
+		os.Exit(2)
+	}
+	if len(args) > 0 && args[0] == "ban" {
+		os.Exit(banMain(c, args[1:]))
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(migrateMain(c, args[1:]))
+	}
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "error: unexpected arguments %q\n", args)
+		os.Exit(2)
+	}
+
+	if err := serve(c); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs atlas until it fails or is interrupted, then shuts it down.
+func serve(c config) error {
+	if err := os.MkdirAll(c.DataDir, 0777); err != nil {
+		return fmt.Errorf("create data directory: %w", err)
 	}
 
 	var cfg atlas.Config
 
-	if db, err := pdatadb.Open("./data/pdata.db"); err != nil {
-		panic(fmt.Errorf("pdatadb: open: %w", err))
-	} else {
-		if cur, to, err := db.Version(); err != nil {
-			panic(fmt.Errorf("pdatadb: migrate: %w", err))
-		} else if cur > to {
-			panic(fmt.Errorf("pdatadb: migrate: database version %d is too new", cur))
-		} else if cur != to {
-			if err := db.MigrateUp(context.Background(), to); err != nil {
-				panic(fmt.Errorf("pdatadb: migrate: migrate (%d to %d): %w", cur, to, err))
-			}
+	pdb, err := pdatadb.Open(filepath.Join(c.DataDir, "pdata.db"), c.sqliteOptions())
+	if err != nil {
+		return fmt.Errorf("pdatadb: open: %w", err)
+	}
+	defer func() {
+		if err := pdb.Close(); err != nil {
+			slog.Error("failed to close pdatadb", "error", err)
 		}
-		cfg.PdataStorage = db
+	}()
+	if err := checkVersion(context.Background(), "pdata", pdb, c.AutoMigrate); err != nil {
+		return err
 	}
+	cfg.PdataStorage = pdb
 
-	if db, err := sessiondb.Open("./data/session.db"); err != nil {
-		panic(fmt.Errorf("sessiondb: open: %w", err))
-	} else {
-		if cur, to, err := db.Version(); err != nil {
-			panic(fmt.Errorf("sessiondb: migrate: %w", err))
-		} else if cur > to {
-			panic(fmt.Errorf("sessiondb: migrate: database version %d is too new", cur))
-		} else if cur != to {
-			if err := db.MigrateUp(context.Background(), to); err != nil {
-				panic(fmt.Errorf("sessiondb: migrate: migrate (%d to %d): %w", cur, to, err))
-			}
+	sdb, err := sessiondb.Open(filepath.Join(c.DataDir, "session.db"), c.sqliteOptions())
+	if err != nil {
+		return fmt.Errorf("sessiondb: open: %w", err)
+	}
+	defer func() {
+		if err := sdb.Close(); err != nil {
+			slog.Error("failed to close sessiondb", "error", err)
+		}
+	}()
+	if err := checkVersion(context.Background(), "session", sdb, c.AutoMigrate); err != nil {
+		return err
+	}
+	cfg.SessionStorage = sdb
+
+	errc := make(chan error, 2)
+
+	if c.UDPAddr != "" {
+		addr, _ := net.ResolveUDPAddr("udp", c.UDPAddr) // already validated
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return fmt.Errorf("nspkt: listen: %w", err)
 		}
-		cfg.SessionStorage = db
+		l := nspkt.NewListener()
+		go func() {
+			if err := l.Serve(conn); err != nil {
+				errc <- fmt.Errorf("nspkt: serve: %w", err)
+			}
+		}()
+		defer l.Close()
+		cfg.Listener = l
+	} else {
+		slog.Warn("udp listener disabled, servers cannot be verified")
+	}
+
+	switch c.PlayerAuth {
+	case "origin":
+		cfg.PlayerAuth = &atlas.OriginPlayerAuthenticator{} // no username source, so usernames stay empty
+	case "fake":
+		slog.Warn("using fake player authentication, any token is accepted as the username")
+		cfg.PlayerAuth = &atlas.FakePlayerAuthenticator{}
+	}
+	cfg.SessionTTL = c.SessionTTL
+	cfg.PlayerAuthTTL = c.PlayerAuthTTL
+	cfg.ServerAuthTTL = c.ServerAuthTTL
+	cfg.ServerTTL = c.ServerTTL
+	cfg.PdataLockTTL = c.PdataLockTTL
+	cfg.IP2Location = c.IP2Location
+	cfg.MainMenuPromos = c.MainMenuPromos
+	cfg.AdminToken = c.AdminToken
+
+	if cfg.AdminToken == "" {
+		slog.Warn("no admin token configured, /metrics is public")
 	}
 
 	h, err := atlas.New(cfg)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer func() {
+		if err := h.Close(); err != nil {
+			slog.Error("failed to close handler", "error", err)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return fmt.Errorf("http: listen: %w", err)
 	}
 
-	panic(http.ListenAndServe(":8080", h))
+	runCtx, runCancel := context.WithCancel(context.Background())
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		h.Run(runCtx)
+	}()
+	defer func() {
+		runCancel()
+		<-runDone
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			if err := h.ReloadPromos(); err != nil {
+				slog.Error("failed to reload main menu promos", "error", err)
+			}
+		}
+	}()
+
+	srv := &http.Server{
+		Handler: h,
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			errc <- fmt.Errorf("http: serve: %w", err)
+		}
+	}()
+	slog.Info("listening", "addr", ln.Addr().String(), "udp_addr", c.UDPAddr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		stop() // a second signal exits immediately
+		slog.Info("shutting down", "timeout", c.ShutdownTimeout)
+	case err = <-errc:
+		slog.Error("shutting down after error", "error", err)
+	}
+
+	h.Shutdown()
+
+	sctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+	if serr := srv.Shutdown(sctx); serr != nil {
+		slog.Warn("failed to drain requests, closing remaining connections", "error", serr)
+		srv.Close()
+	}
+	return err
 }
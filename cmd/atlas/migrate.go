@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/r2northstar/atlas/v2/db/pdatadb"
+	"github.com/r2northstar/atlas/v2/db/sessiondb"
+)
+
+const migrateUsage = `usage: atlas [options] migrate status
+       atlas [options] migrate up [-dry-run] [-db pdata|session] [version]
+       atlas [options] migrate down [-dry-run] -db pdata|session version
+`
+
+// migrator is implemented by the databases.
+type migrator interface {
+	Version() (current, required uint64, err error)
+	MigrateUp(ctx context.Context, to uint64) error
+	MigrateUpDryRun(ctx context.Context, to uint64) error
+	MigrateDown(ctx context.Context, to uint64) error
+	MigrateDownDryRun(ctx context.Context, to uint64) error
+	Close() error
+}
+
+// namedDB is a database along with its name. DB is nil if the database
+// doesn't exist and wasn't created.
+type namedDB struct {
+	Name string
+	DB   migrator
+}
+
+// openDBs opens the databases in the data directory. If create is false,
+// databases which don't exist yet are skipped rather than created.
+func openDBs(c config, create bool) ([]namedDB, error) {
+	dbs := []namedDB{{Name: "pdata"}, {Name: "session"}}
+	for i := range dbs {
+		name := filepath.Join(c.DataDir, dbs[i].Name+".db")
+		if !create {
+			if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				closeDBs(dbs)
+				return nil, fmt.Errorf("%sdb: %w", dbs[i].Name, err)
+			}
+		}
+		var err error
+		switch dbs[i].Name {
+		case "pdata":
+			dbs[i].DB, err = pdatadb.Open(name, c.sqliteOptions())
+		case "session":
+			dbs[i].DB, err = sessiondb.Open(name, c.sqliteOptions())
+		}
+		if err != nil {
+			dbs[i].DB = nil
+			closeDBs(dbs)
+			return nil, fmt.Errorf("%sdb: open: %w", dbs[i].Name, err)
+		}
+	}
+	return dbs, nil
+}
+
+// closeDBs closes the databases opened by openDBs.
+func closeDBs(dbs []namedDB) {
+	for _, db := range dbs {
+		if db.DB != nil {
+			db.DB.Close()
+		}
+	}
+}
+
+// checkVersion ensures db is at the required version, migrating it up if auto
+// is true.
+func checkVersion(ctx context.Context, name string, db migrator, auto bool) error {
+	cur, to, err := db.Version()
+	if err != nil {
+		return fmt.Errorf("%sdb: migrate: %w", name, err)
+	}
+	switch {
+	case cur > to:
+		return fmt.Errorf("%sdb: migrate: database version %d is too new", name, cur)
+	case cur == to:
+		return nil
+	case !auto:
+		return fmt.Errorf("%sdb: database version %d does not match %d (run atlas migrate up, or enable auto-migrate)", name, cur, to)
+	}
+	if err := db.MigrateUp(ctx, to); err != nil {
+		return fmt.Errorf("%sdb: migrate: migrate (%d to %d): %w", name, cur, to, err)
+	}
+	return nil
+}
+
+// migrateMain runs the database migration commands.
+func migrateMain(c config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("migrate "+cmd, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "apply the migration in a transaction, then roll it back")
+	only := fs.String("db", "", "database to migrate (pdata or session)")
+
+	var (
+		to    uint64
+		hasTo bool
+	)
+	switch cmd {
+	case "status":
+		if len(args) != 0 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "up", "down":
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() > 1 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		if *only != "" && *only != "pdata" && *only != "session" {
+			fmt.Fprintf(os.Stderr, "error: unknown database %q (expected pdata or session)\n", *only)
+			return 2
+		}
+		if fs.NArg() == 1 {
+			v, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: invalid version %q\n", fs.Arg(0))
+				return 2
+			}
+			to, hasTo = v, true
+		}
+		if hasTo && *only == "" {
+			fmt.Fprintf(os.Stderr, "error: -db is required when a version is specified\n")
+			return 2
+		}
+		if cmd == "down" && !hasTo {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if cmd == "up" && !*dryRun {
+		if err := os.MkdirAll(c.DataDir, 0777); err != nil {
+			fmt.Fprintf(os.Stderr, "error: create data directory: %v\n", err)
+			return 1
+		}
+	} else if _, err := os.Stat(c.DataDir); err != nil {
+		fmt.Fprintf(os.Stderr, "error: data directory: %v\n", err)
+		return 1
+	}
+
+	// only a real migration up may create the databases
+	dbs, err := openDBs(c, cmd == "up" && !*dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDBs(dbs)
+
+	ctx := context.Background()
+
+	var failed bool
+	for _, db := range dbs {
+		if *only != "" && db.Name != *only {
+			continue
+		}
+
+		if db.DB == nil {
+			switch cmd {
+			case "status":
+				fmt.Printf("%sdb: does not exist (run atlas migrate up to create it)\n", db.Name)
+			case "up":
+				fmt.Printf("%sdb: does not exist, skipping dry run (run atlas migrate up to create it)\n", db.Name)
+			default:
+				fmt.Fprintf(os.Stderr, "error: %sdb: does not exist\n", db.Name)
+				failed = true
+			}
+			continue
+		}
+
+		cur, latest, err := db.DB.Version()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %sdb: %v\n", db.Name, err)
+			failed = true
+			continue
+		}
+
+		if cmd == "status" {
+			switch {
+			case cur == latest:
+				fmt.Printf("%sdb: version %d (up to date)\n", db.Name, cur)
+			case cur > latest:
+				fmt.Printf("%sdb: version %d (too new, latest supported is %d)\n", db.Name, cur, latest)
+			default:
+				fmt.Printf("%sdb: version %d (%d pending, latest is %d)\n", db.Name, cur, latest-cur, latest)
+			}
+			continue
+		}
+
+		target := latest
+		if hasTo {
+			target = to
+		}
+		if target == cur {
+			fmt.Printf("%sdb: already at version %d\n", db.Name, cur)
+			continue
+		}
+
+		var fn func(context.Context, uint64) error
+		switch {
+		case cmd == "up" && *dryRun:
+			fn = db.DB.MigrateUpDryRun
+		case cmd == "up":
+			fn = db.DB.MigrateUp
+		case *dryRun:
+			fn = db.DB.MigrateDownDryRun
+		default:
+			fn = db.DB.MigrateDown
+		}
+		if err := fn(ctx, target); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %sdb: migrate %s (%d to %d): %v\n", db.Name, cmd, cur, target, err)
+			failed = true
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("%sdb: migrated %s from %d to %d (dry run, rolled back)\n", db.Name, cmd, cur, target)
+		} else {
+			fmt.Printf("%sdb: migrated %s from %d to %d\n", db.Name, cmd, cur, target)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
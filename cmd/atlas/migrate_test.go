@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateNoCreate(t *testing.T) {
+	dir := t.TempDir()
+	c, _, err := loadConfig([]string{"-data-dir", dir})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	files := func() []string {
+		t.Helper()
+		es, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("read data dir: %v", err)
+		}
+		var names []string
+		for _, e := range es {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		Args []string
+		Code int
+	}{
+		{[]string{"status"}, 0},
+		{[]string{"up", "-dry-run"}, 0},
+		{[]string{"down", "-dry-run", "-db", "pdata", "0"}, 1},
+		{[]string{"down", "-db", "session", "0"}, 1},
+	} {
+		if code := migrateMain(c, tc.Args); code != tc.Code {
+			t.Errorf("%q: expected exit code %d, got %d", tc.Args, tc.Code, code)
+		}
+		if names := files(); len(names) != 0 {
+			t.Errorf("%q: expected no files to be created, got %q", tc.Args, names)
+		}
+	}
+
+	if code := migrateMain(c, []string{"up"}); code != 0 {
+		t.Fatalf("migrate up: exit code %d", code)
+	}
+	for _, name := range []string{"pdata.db", "session.db"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected migrate up to create %s: %v", name, err)
+		}
+	}
+	if code := migrateMain(c, []string{"status"}); code != 0 {
+		t.Errorf("migrate status: exit code %d", code)
+	}
+
+	c.DataDir = filepath.Join(dir, "missing")
+	if code := migrateMain(c, []string{"status"}); code != 1 {
+		t.Errorf("expected status to fail for a missing data directory, got exit code %d", code)
+	}
+	if _, err := os.Stat(c.DataDir); !os.IsNotExist(err) {
+		t.Errorf("expected the data directory not to be created")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+)
+
+// fieldDiff is a pdata field which differs.
+type fieldDiff struct {
+	Path string // e.g., pilotLoadouts[2].primary
+	A, B string // formatted values
+}
+
+// diffPdata returns the fields which differ between a and b.
+func diffPdata(a, b pdata.Pdata) []fieldDiff {
+	var ds []fieldDiff
+	diffStruct(&ds, reflect.ValueOf(a), reflect.ValueOf(b), "")
+	if !bytes.Equal(a.ExtraData, b.ExtraData) {
+		ds = append(ds, fieldDiff{
+			Path: "_extraData",
+			A:    strconv.Quote(base64.StdEncoding.EncodeToString(a.ExtraData)),
+			B:    strconv.Quote(base64.StdEncoding.EncodeToString(b.ExtraData)),
+		})
+	}
+	return ds
+}
+
+func diffStruct(ds *[]fieldDiff, a, b reflect.Value, path string) {
+	typ := a.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("pdef"), ",")
+		if name == "" {
+			continue
+		}
+		fldPath := name
+		if path != "" {
+			fldPath = path + "." + name
+		}
+
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Array {
+			for j := 0; j < fa.Len(); j++ {
+				diffValue(ds, fa.Index(j), fb.Index(j), fldPath+"["+strconv.Itoa(j)+"]")
+			}
+			continue
+		}
+		diffValue(ds, fa, fb, fldPath)
+	}
+}
+
+func diffValue(ds *[]fieldDiff, a, b reflect.Value, path string) {
+	if a.Kind() == reflect.Struct {
+		diffStruct(ds, a, b, path)
+		return
+	}
+	if x, y := formatValue(a), formatValue(b); x != y {
+		*ds = append(*ds, fieldDiff{path, x, y})
+	}
+}
+
+// formatValue formats a primitive pdata value.
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Uint8:
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			if t, err := m.MarshalText(); err == nil {
+				return string(t)
+			}
+			return "<invalid " + strconv.FormatUint(v.Uint(), 10) + ">"
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
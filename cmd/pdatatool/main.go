@@ -0,0 +1,430 @@
+// Command pdatatool inspects and edits Titanfall 2 player data.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/r2northstar/atlas/v2/db/pdatadb"
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const usage = `usage: pdatatool decode [-filter path,...] [-compact] [-o file] [file]
+       pdatatool encode [-base file] [-o file] [file]
+       pdatatool validate [-enums=false] file...
+       pdatatool diff a b
+       pdatatool get [-raw] [-filter path,...] [-compact] [-o file] pdata.db uid
+
+files may be binary pdata or json (as output by decode), and - or no file
+means stdin. filter paths are dot-separated field names (e.g.,
+pilotLoadouts.primary), where * matches any field.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var fn func([]string) int
+	switch os.Args[1] {
+	case "decode":
+		fn = decodeMain
+	case "encode":
+		fn = encodeMain
+	case "validate":
+		fn = validateMain
+	case "diff":
+		fn = diffMain
+	case "get":
+		fn = getMain
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(fn(os.Args[2:]))
+}
+
+// parseArgs parses fs from args, allowing flags after positional arguments,
+// and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, bool) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, false
+		}
+		if fs.NArg() == 0 {
+			return pos, true
+		}
+		pos, args = append(pos, fs.Arg(0)), fs.Args()[1:]
+	}
+}
+
+// newFlagSet creates a flag set for a subcommand.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("pdatatool "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+	}
+	return fs
+}
+
+func decodeMain(args []string) int {
+	fs := newFlagSet("decode")
+	filter := fs.String("filter", "", "comma-separated field paths to include")
+	compact := fs.Bool("compact", false, "don't indent the json")
+	output := fs.String("o", "", "output file (default: stdout)")
+	args, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if len(args) > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	pd, err := readPdata(arg(args, 0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return writeJSON(pd, *filter, *compact, *output)
+}
+
+func encodeMain(args []string) int {
+	fs := newFlagSet("encode")
+	base := fs.String("base", "", "pdata to apply the json to (for partial json, e.g., from decode -filter)")
+	output := fs.String("o", "", "output file (default: stdout)")
+	args, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if len(args) > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var pd pdata.Pdata
+	if *base != "" {
+		var err error
+		if pd, err = readPdata(*base); err != nil {
+			fmt.Fprintf(os.Stderr, "error: base: %v\n", err)
+			return 1
+		}
+	}
+
+	buf, err := readFile(arg(args, 0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if !isJSON(buf) {
+		fmt.Fprintf(os.Stderr, "error: input is not json\n")
+		return 1
+	}
+	if err := pd.UnmarshalJSON(buf); err != nil {
+		if *base == "" && errors.Is(err, pdata.ErrUnsupportedVersion) {
+			fmt.Fprintf(os.Stderr, "error: %v (use -base to encode partial json)\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		return 1
+	}
+
+	if buf, err = pd.MarshalBinary(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: encode: %v\n", err)
+		return 1
+	}
+	if err := writeFile(*output, buf); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func validateMain(args []string) int {
+	fs := newFlagSet("validate")
+	enums := fs.Bool("enums", true, "check for unknown enum values")
+	args, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var failed bool
+	for _, name := range args {
+		pd, err := readPdata(name)
+		if err == nil && *enums {
+			if err = pd.ValidateEnums(); err != nil {
+				err = fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+		} else {
+			fmt.Printf("%s: ok\n", name)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func diffMain(args []string) int {
+	fs := newFlagSet("diff")
+	args, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if len(args) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	a, err := readPdata(arg(args, 0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	b, err := readPdata(arg(args, 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+
+	ds := diffPdata(a, b)
+	for _, d := range ds {
+		fmt.Printf("%s: %s -> %s\n", d.Path, d.A, d.B)
+	}
+	if len(ds) != 0 {
+		return 1
+	}
+	return 0
+}
+
+func getMain(args []string) int {
+	fs := newFlagSet("get")
+	raw := fs.Bool("raw", false, "output binary pdata instead of json")
+	filter := fs.String("filter", "", "comma-separated field paths to include")
+	compact := fs.Bool("compact", false, "don't indent the json")
+	output := fs.String("o", "", "output file (default: stdout)")
+	args, ok := parseArgs(fs, args)
+	if !ok {
+		return 2
+	}
+	if len(args) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	uid, err := strconv.ParseUint(arg(args, 1), 10, 64)
+	if err != nil || uid == 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid uid %q\n", arg(args, 1))
+		return 2
+	}
+
+	// don't let sqlite create a new database
+	if _, err := os.Stat(arg(args, 0)); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	db, err := pdatadb.Open(arg(args, 0), pdatadb.Options{ReadOnly: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: pdatadb: open: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if cur, to, err := db.Version(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: pdatadb: get version: %v\n", err)
+		return 1
+	} else if cur != to {
+		fmt.Fprintf(os.Stderr, "error: pdatadb: database version %d does not match %d\n", cur, to)
+		return 1
+	}
+
+	buf, exists, err := db.GetPdataCached(uid, [sha256.Size]byte{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: pdatadb: get pdata: %v\n", err)
+		return 1
+	}
+	if !exists {
+		fmt.Fprintf(os.Stderr, "error: no pdata for uid %d\n", uid)
+		return 1
+	}
+
+	if *raw {
+		if err := writeFile(*output, buf); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	var pd pdata.Pdata
+	if err := pd.UnmarshalBinary(buf); err != nil {
+		fmt.Fprintf(os.Stderr, "error: decode: %v\n", err)
+		return 1
+	}
+	return writeJSON(pd, *filter, *compact, *output)
+}
+
+// arg gets the ith argument, or an empty string.
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// readFile reads a file, or stdin if name is empty or -.
+func readFile(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// writeFile writes a file, or stdout if name is empty or -.
+func writeFile(name string, buf []byte) error {
+	if name == "" || name == "-" {
+		_, err := os.Stdout.Write(buf)
+		return err
+	}
+	return os.WriteFile(name, buf, 0666)
+}
+
+// isJSON checks whether buf looks like a json object rather than binary pdata.
+func isJSON(buf []byte) bool {
+	buf = bytes.TrimLeft(buf, " \t\r\n")
+	return len(buf) != 0 && buf[0] == '{'
+}
+
+// readPdata reads binary or json pdata.
+func readPdata(name string) (pdata.Pdata, error) {
+	var pd pdata.Pdata
+	buf, err := readFile(name)
+	if err != nil {
+		return pd, err
+	}
+	if isJSON(buf) {
+		err = pd.UnmarshalJSON(buf)
+	} else {
+		err = pd.UnmarshalBinary(buf)
+	}
+	if err != nil {
+		if name == "" {
+			name = "-"
+		}
+		return pd, fmt.Errorf("%s: %w", name, err)
+	}
+	return pd, nil
+}
+
+// writeJSON writes pd as json, optionally filtered.
+func writeJSON(pd pdata.Pdata, filter string, compact bool, output string) int {
+	buf, err := pd.MarshalJSONFilter(parseFilter(filter))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: encode json: %v\n", err)
+		return 1
+	}
+	if !compact {
+		var b bytes.Buffer
+		if err := json.Indent(&b, buf, "", "  "); err != nil {
+			fmt.Fprintf(os.Stderr, "error: encode json: %v\n", err)
+			return 1
+		}
+		buf = b.Bytes()
+	}
+	buf = append(buf, '\n')
+	if err := writeFile(output, buf); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseFilter parses comma-separated dot-separated field paths into a filter
+// for [pdata.Pdata.MarshalJSONFilter]. A field is included if it is a parent or
+// child of any of the paths. If s is empty, nil is returned.
+//
+// Since the filter is only given the field path, fields which could only be
+// parents of a path (i.e., the path is longer) are only included if they have
+// child fields.
+func parseFilter(s string) func(path ...string) bool {
+	if s == "" {
+		return nil
+	}
+	var filters [][]string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			filters = append(filters, strings.Split(x, "."))
+		}
+	}
+	return func(path ...string) bool {
+		for _, f := range filters {
+			if matchPath(f, path) && (len(path) >= len(f) || hasFields(path)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchPath checks whether path is a parent or child of filter.
+func matchPath(filter, path []string) bool {
+	for i := 0; i < len(filter) && i < len(path); i++ {
+		if filter[i] != "*" && filter[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFields checks whether the pdata field at path is a struct (or an array of
+// them).
+func hasFields(path []string) bool {
+	typ := reflect.TypeOf(pdata.Pdata{})
+	for _, name := range path {
+		field, ok := pdataField(typ, name)
+		if !ok {
+			return false
+		}
+		if typ = field.Type; typ.Kind() == reflect.Array {
+			typ = typ.Elem()
+		}
+	}
+	return typ.Kind() == reflect.Struct
+}
+
+// pdataField gets the field of a pdata struct by its pdef name.
+func pdataField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	if typ.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if n, _, _ := strings.Cut(typ.Field(i).Tag.Get("pdef"), ","); n != "" && n == name {
+			return typ.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
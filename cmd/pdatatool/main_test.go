@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+)
+
+func TestParseFilter(t *testing.T) {
+	if f := parseFilter(""); f != nil {
+		t.Errorf("expected nil filter for an empty string")
+	}
+
+	f := parseFilter("xp, pilotLoadouts.primary,,*.name")
+	for _, tc := range []struct {
+		Path  []string
+		Match bool
+	}{
+		{[]string{"xp"}, true},
+		{[]string{"previousXP"}, false},
+		{[]string{"pilotLoadouts"}, true},                     // parent
+		{[]string{"pilotLoadouts", "primary"}, true},          // exact
+		{[]string{"pilotLoadouts", "primary", "child"}, true}, // child
+		{[]string{"pilotLoadouts", "secondary"}, false},       // sibling
+		{[]string{"titanLoadouts", "name"}, true},             // wildcard
+		{[]string{"titanLoadouts", "primary"}, false},         // wildcard sibling
+		{[]string{"titanLoadouts"}, true},                     // wildcard parent
+	} {
+		if m := f(tc.Path...); m != tc.Match {
+			t.Errorf("filter(%q): expected %t, got %t", tc.Path, tc.Match, m)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	for _, tc := range []struct {
+		Filter, Path []string
+		Match        bool
+	}{
+		{[]string{"a"}, []string{"a"}, true},
+		{[]string{"a"}, []string{"b"}, false},
+		{[]string{"a", "b"}, []string{"a"}, true},
+		{[]string{"a"}, []string{"a", "b"}, true},
+		{[]string{"a", "b"}, []string{"a", "c"}, false},
+		{[]string{"*", "b"}, []string{"x", "b"}, true},
+		{[]string{"*"}, []string{"x", "y"}, true},
+		{[]string{"a"}, nil, true},
+	} {
+		if m := matchPath(tc.Filter, tc.Path); m != tc.Match {
+			t.Errorf("matchPath(%q, %q): expected %t, got %t", tc.Filter, tc.Path, tc.Match, m)
+		}
+	}
+}
+
+func TestDiffPdata(t *testing.T) {
+	var a pdata.Pdata
+	if err := a.UnmarshalBinary(pdata.DefaultPdata); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if ds := diffPdata(a, a); len(ds) != 0 {
+		t.Errorf("expected no differences, got %v", ds)
+	}
+
+	b := a
+	b.Xp = a.Xp + 100
+	b.PilotLoadouts[2].Name = "test"
+	b.LastAbandonedMode = 0xFF
+	b.ExtraData = []byte{1}
+
+	exp := []fieldDiff{
+		{"xp", formatValue(reflect.ValueOf(a.Xp)), formatValue(reflect.ValueOf(b.Xp))},
+		{"pilotLoadouts[2].name", `"` + a.PilotLoadouts[2].Name + `"`, `"test"`},
+		{"lastAbandonedMode", formatValue(reflect.ValueOf(a.LastAbandonedMode)), "<invalid 255>"},
+		{"_extraData", strconv.Quote(base64.StdEncoding.EncodeToString(a.ExtraData)), `"AQ=="`},
+	}
+	if ds := diffPdata(a, b); !reflect.DeepEqual(ds, exp) {
+		t.Errorf("expected %v, got %v", exp, ds)
+	}
+}
@@ -0,0 +1,195 @@
+// Package migrate implements versioned schema migrations for sqlite3
+// databases, using the user_version pragma to store the current version.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrIrreversible is returned when migrating down past an irreversible
+// migration.
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// Func applies or reverts a migration.
+type Func func(context.Context, *sqlx.Tx) error
+
+// Migration is a single schema version.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      Func
+	Down    Func // nil if irreversible
+}
+
+// Set contains the migrations for a database. The zero value is an empty set.
+type Set struct {
+	m map[uint64]Migration
+}
+
+// Add adds a migration from the calling file, which must be named like
+// 001_name.go, where 001 is the version. If down is nil, the migration is
+// irreversible. It should be called from init.
+func (s *Set) Add(up, down Func) {
+	_, fn, _, ok := runtime.Caller(1)
+	if !ok {
+		panic("add migration: failed to get filename")
+	}
+	fn = path.Base(strings.ReplaceAll(fn, `\`, `/`))
+
+	n, name, ok := strings.Cut(strings.TrimSuffix(fn, ".go"), "_")
+	if !ok {
+		panic("add migration: failed to parse filename")
+	}
+	v, err := strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		panic("add migration: failed to parse filename: " + err.Error())
+	}
+	s.add(Migration{v, name, up, down})
+}
+
+func (s *Set) add(m Migration) {
+	if m.Version == 0 {
+		panic("add migration: version must not be 0")
+	}
+	if m.Up == nil {
+		panic("add migration: up must not be nil")
+	}
+	if _, exists := s.m[m.Version]; exists {
+		panic("add migration: duplicate version " + strconv.FormatUint(m.Version, 10))
+	}
+	if s.m == nil {
+		s.m = make(map[uint64]Migration)
+	}
+	s.m[m.Version] = m
+}
+
+// Versions returns the migration versions in ascending order.
+func (s *Set) Versions() []uint64 {
+	vs := make([]uint64, 0, len(s.m))
+	for v := range s.m {
+		vs = append(vs, v)
+	}
+	slices.Sort(vs)
+	return vs
+}
+
+// Latest returns the latest migration version, or 0 if there are none.
+func (s *Set) Latest() uint64 {
+	var latest uint64
+	for v := range s.m {
+		latest = max(latest, v)
+	}
+	return latest
+}
+
+// Floor returns the lowest version the database can be migrated down to from
+// version cur.
+func (s *Set) Floor(cur uint64) uint64 {
+	var floor uint64
+	for v, m := range s.m {
+		if v <= cur && m.Down == nil {
+			floor = max(floor, v)
+		}
+	}
+	return floor
+}
+
+// Version gets the current database version.
+func Version(ctx context.Context, db *sqlx.DB) (uint64, error) {
+	var cur uint64
+	if err := db.GetContext(ctx, &cur, `PRAGMA user_version`); err != nil {
+		return 0, fmt.Errorf("get version: %w", err)
+	}
+	return cur, nil
+}
+
+// Up migrates the database up to the provided version. If dryRun is true, the
+// transaction is rolled back instead of committed.
+func (s *Set) Up(ctx context.Context, db *sqlx.DB, to uint64, dryRun bool) error {
+	return s.run(ctx, db, to, dryRun, true)
+}
+
+// Down migrates the database down to the provided version, failing with
+// [ErrIrreversible] if any of the migrations can't be reverted. If dryRun is
+// true, the transaction is rolled back instead of committed. This will
+// probably eat your data.
+func (s *Set) Down(ctx context.Context, db *sqlx.DB, to uint64, dryRun bool) error {
+	return s.run(ctx, db, to, dryRun, false)
+}
+
+func (s *Set) run(ctx context.Context, db *sqlx.DB, to uint64, dryRun, up bool) error {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var cv uint64
+	if err = tx.GetContext(ctx, &cv, `PRAGMA user_version`); err != nil {
+		return fmt.Errorf("get version: %w", err)
+	}
+	if _, ok := s.m[cv]; !ok && cv != 0 {
+		return fmt.Errorf("unsupported db version %d", cv)
+	}
+	if _, ok := s.m[to]; !ok && to != 0 {
+		return fmt.Errorf("unknown db version %d", to)
+	}
+
+	var ms []Migration
+	if up {
+		if to < cv {
+			return fmt.Errorf("target version %d is less than current version %d", to, cv)
+		}
+		for _, v := range s.Versions() {
+			if v > cv && v <= to {
+				ms = append(ms, s.m[v])
+			}
+		}
+	} else {
+		if cv < to {
+			return fmt.Errorf("current version %d is less than target version %d", cv, to)
+		}
+		vs := s.Versions()
+		slices.Reverse(vs)
+		for _, v := range vs {
+			if v <= cv && v > to {
+				if s.m[v].Down == nil {
+					return fmt.Errorf("migrate %d (%s): %w, so the db cannot be migrated below version %d", v, s.m[v].Name, ErrIrreversible, v)
+				}
+				ms = append(ms, s.m[v])
+			}
+		}
+	}
+
+	for _, m := range ms {
+		fn := m.Up
+		if !up {
+			fn = m.Down
+		}
+		if err := fn(ctx, tx); err != nil {
+			return fmt.Errorf("migrate %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `PRAGMA user_version = `+strconv.FormatUint(to, 10)); err != nil {
+		return fmt.Errorf("update version: %w", err)
+	}
+
+	if dryRun {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func testSet() *Set {
+	table := func(name string) (Func, Func) {
+		return func(ctx context.Context, tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, `CREATE TABLE `+name+` (x INTEGER) STRICT`)
+				return err
+			}, func(ctx context.Context, tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, `DROP TABLE `+name)
+				return err
+			}
+	}
+	var s Set
+	up1, down1 := table("a")
+	up2, _ := table("b")
+	up3, down3 := table("c")
+	s.add(Migration{1, "a", up1, down1})
+	s.add(Migration{2, "b", up2, nil})
+	s.add(Migration{3, "c", up3, down3})
+	return &s
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	s := testSet()
+
+	if v := s.Latest(); v != 3 {
+		t.Errorf("expected latest version 3, got %d", v)
+	}
+	for cur, floor := range []uint64{0, 0, 2, 2} {
+		if v := s.Floor(uint64(cur)); v != floor {
+			t.Errorf("expected floor %d for version %d, got %d", floor, cur, v)
+		}
+	}
+
+	for _, tc := range []struct {
+		Name   string
+		Down   bool
+		To     uint64
+		DryRun bool
+		Err    error // nil to not check the error type
+		Fail   bool
+		Result uint64
+	}{
+		{Name: "UpUnknown", To: 4, Fail: true, Result: 0},
+		{Name: "UpDryRun", To: 3, DryRun: true, Result: 0},
+		{Name: "Up", To: 1, Result: 1},
+		{Name: "UpAgain", To: 3, Result: 3},
+		{Name: "UpBackwards", To: 1, Fail: true, Result: 3},
+		{Name: "DownIrreversible", Down: true, To: 0, Err: ErrIrreversible, Fail: true, Result: 3},
+		{Name: "DownIrreversibleDryRun", Down: true, To: 1, DryRun: true, Err: ErrIrreversible, Fail: true, Result: 3},
+		{Name: "DownDryRun", Down: true, To: 2, DryRun: true, Result: 3},
+		{Name: "Down", Down: true, To: 2, Result: 2},
+		{Name: "DownForwards", Down: true, To: 3, Fail: true, Result: 2},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var err error
+			if tc.Down {
+				err = s.Down(ctx, db, tc.To, tc.DryRun)
+			} else {
+				err = s.Up(ctx, db, tc.To, tc.DryRun)
+			}
+			if tc.Fail {
+				if err == nil {
+					t.Errorf("expected error")
+				} else if tc.Err != nil && !errors.Is(err, tc.Err) {
+					t.Errorf("expected error %v, got %v", tc.Err, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if v, err := Version(ctx, db); err != nil {
+				t.Fatalf("get version: %v", err)
+			} else if v != tc.Result {
+				t.Errorf("expected version %d, got %d", tc.Result, v)
+			}
+		})
+	}
+
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('a', 'b', 'c')`); err != nil {
+		t.Fatalf("count tables: %v", err)
+	} else if n != 2 {
+		t.Errorf("expected tables a and b to remain, got %d tables", n)
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func init() {
-	migrate(up001, down001)
+	migrations.Add(up001, down001)
 }
 
 func up001(ctx context.Context, tx *sqlx.Tx) error {
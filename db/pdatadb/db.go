@@ -8,43 +8,89 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/klauspost/compress/gzip"
+	"github.com/r2northstar/atlas/v2/db/sqlite"
 )
 
 // DB stores player data in a sqlite3 database.
 type DB struct {
 	x     *sqlx.DB
+	ro    bool
 	gzipW sync.Pool
 	gzipR sync.Pool
+
+	metrics struct {
+		read_count  atomic.Uint64
+		write_count atomic.Uint64
+		read_bytes  struct {
+			raw    atomic.Uint64
+			stored atomic.Uint64
+		}
+		write_bytes struct {
+			raw    atomic.Uint64
+			stored atomic.Uint64
+		}
+	}
 }
 
+// Options contains sqlite3 tuning options. Zero values use the defaults, and
+// the busy timeout defaults to 6s.
+type Options = sqlite.Options
+
 // Open opens a DB from the provided sqlite3 uri.
-func Open(name string) (*DB, error) {
-	// note: WAL and a larger pagesize makes our writes and queries MUCH faster
-	x, err := sqlx.Connect("sqlite3", (&url.URL{
-		Path: name,
-		RawQuery: (url.Values{
-			"_journal":      {"WAL"},
-			"_synchronous":  {"NORMAL"},
-			"_busy_timeout": {"6000"},
-			"_cache_size":   {"-16000"},
-		}).Encode(),
-	}).String())
+func Open(name string, opt Options) (*DB, error) {
+	x, err := sqlite.Open(name, opt, time.Second*6)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := x.Exec(`PRAGMA page_size = 8192`); err != nil {
-		panic(err)
+	// note: WAL and a larger pagesize makes our writes and queries MUCH faster
+	if !opt.ReadOnly {
+		if _, err := x.Exec(`PRAGMA page_size = 8192`); err != nil {
+			x.Close()
+			return nil, fmt.Errorf("set page size: %w", err)
+		}
 	}
-	return &DB{x: x}, nil
+	return &DB{x: x, ro: opt.ReadOnly}, nil
 }
 
+// Close checkpoints the write-ahead log (unless the database is read-only) and
+// closes the database.
 func (db *DB) Close() error {
-	return db.x.Close()
+	return sqlite.Close(db.x, db.ro)
+}
+
+// DBStats returns database connection pool statistics.
+func (db *DB) DBStats() sql.DBStats {
+	return db.x.Stats()
+}
+
+// WritePrometheus writes prometheus text metrics to w.
+func (db *DB) WritePrometheus(w io.Writer) {
+	fmt.Fprintln(w, `# HELP atlas_pdatadb_read_count Pdata reads.`)
+	fmt.Fprintln(w, `# TYPE atlas_pdatadb_read_count counter`)
+	fmt.Fprintln(w, `atlas_pdatadb_read_count`, db.metrics.read_count.Load())
+	fmt.Fprintln(w, `# HELP atlas_pdatadb_read_bytes Pdata bytes read.`)
+	fmt.Fprintln(w, `# TYPE atlas_pdatadb_read_bytes counter`)
+	fmt.Fprintln(w, `atlas_pdatadb_read_bytes{type="raw"}`, db.metrics.read_bytes.raw.Load())
+	fmt.Fprintln(w, `atlas_pdatadb_read_bytes{type="stored"}`, db.metrics.read_bytes.stored.Load())
+	fmt.Fprintln(w, `# HELP atlas_pdatadb_write_count Pdata writes.`)
+	fmt.Fprintln(w, `# TYPE atlas_pdatadb_write_count counter`)
+	fmt.Fprintln(w, `atlas_pdatadb_write_count`, db.metrics.write_count.Load())
+	fmt.Fprintln(w, `# HELP atlas_pdatadb_write_bytes Pdata bytes written.`)
+	fmt.Fprintln(w, `# TYPE atlas_pdatadb_write_bytes counter`)
+	fmt.Fprintln(w, `atlas_pdatadb_write_bytes{type="raw"}`, db.metrics.write_bytes.raw.Load())
+	fmt.Fprintln(w, `atlas_pdatadb_write_bytes{type="stored"}`, db.metrics.write_bytes.stored.Load())
+	if raw := db.metrics.write_bytes.raw.Load(); raw != 0 {
+		fmt.Fprintln(w, `# HELP atlas_pdatadb_write_compression_ratio Ratio of stored to raw pdata bytes written.`)
+		fmt.Fprintln(w, `# TYPE atlas_pdatadb_write_compression_ratio gauge`)
+		fmt.Fprintln(w, `atlas_pdatadb_write_compression_ratio`, float64(db.metrics.write_bytes.stored.Load())/float64(raw))
+	}
 }
 
 func (db *DB) GetPdataHash(uid uint64) (hash [sha256.Size]byte, exists bool, err error) {
@@ -101,6 +147,8 @@ func (db *DB) GetPdataCached(uid uint64, sha [sha256.Size]byte) (buf []byte, exi
 		return nil, false, err
 	}
 
+	stored := len(obj.Pdata)
+
 	switch obj.PdataComp {
 	case "":
 	case "gzip":
@@ -137,6 +185,10 @@ func (db *DB) GetPdataCached(uid uint64, sha [sha256.Size]byte) (buf []byte, exi
 	if sha256.Sum256(obj.Pdata) != pdataHashB {
 		return nil, false, fmt.Errorf("pdata checksum mismatch")
 	}
+
+	db.metrics.read_count.Add(1)
+	db.metrics.read_bytes.raw.Add(uint64(len(obj.Pdata)))
+	db.metrics.read_bytes.stored.Add(uint64(stored))
 	return obj.Pdata, true, nil
 }
 
@@ -162,6 +214,8 @@ func (db *DB) SetPdata(uid uint64, buf []byte) (n int, err error) {
 		return 0, fmt.Errorf("compress pdata: %w", err)
 	}
 
+	raw := len(buf)
+
 	var pdataComp string
 	if b.Len() < len(buf) {
 		pdataComp = "gzip"
@@ -180,5 +234,9 @@ func (db *DB) SetPdata(uid uint64, buf []byte) (n int, err error) {
 	}); err != nil {
 		return 0, err
 	}
+
+	db.metrics.write_count.Add(1)
+	db.metrics.write_bytes.raw.Add(uint64(raw))
+	db.metrics.write_bytes.stored.Add(uint64(len(buf)))
 	return len(buf), nil
 }
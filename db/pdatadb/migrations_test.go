@@ -2,15 +2,16 @@ package pdatadb
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
-	"sort"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/r2northstar/atlas/v2/db/migrate"
 )
 
 func TestMigrations(t *testing.T) {
-	db, err := Open(filepath.Join(t.TempDir(), "pdata.db"))
+	db, err := Open(filepath.Join(t.TempDir(), "pdata.db"), Options{})
 	if err != nil {
 		panic(err)
 	}
@@ -24,26 +25,44 @@ func TestMigrations(t *testing.T) {
 		t.Fatalf("current version not 0")
 	}
 
-	var ms []uint64
-	for m := range migrations {
-		ms = append(ms, m)
-	}
-	sort.Slice(ms, func(i, j int) bool {
-		return ms[i] < ms[j]
-	})
-
-	for _, to := range ms {
+	var floor uint64
+	for _, to := range migrations.Versions() {
+		if err := db.MigrateUpDryRun(context.Background(), to); err != nil {
+			t.Fatalf("dry run migrate up to %d: %v", to, err)
+		}
+		if cur, _, err := db.Version(); err != nil {
+			t.Fatalf("get version: %v", err)
+		} else if cur != floor {
+			t.Fatalf("dry run migrate up to %d changed version to %d", to, cur)
+		}
 		if err := db.MigrateUp(context.Background(), to); err != nil {
 			t.Fatalf("migrate up to %d: %v", to, err)
 		}
-		if err := db.MigrateDown(context.Background(), 0); err != nil {
-			t.Fatalf("migrate down from %d to 0: %v", to, err)
+
+		// irreversible migrations can't be migrated down past
+		floor = migrations.Floor(to)
+		if floor != 0 {
+			if err := db.MigrateDown(context.Background(), 0); !errors.Is(err, migrate.ErrIrreversible) {
+				t.Fatalf("migrate down from %d to 0: expected irreversible error, got %v", to, err)
+			}
+		}
+
+		if err := db.MigrateDownDryRun(context.Background(), floor); err != nil {
+			t.Fatalf("dry run migrate down from %d to %d: %v", to, floor, err)
+		}
+		if cur, _, err := db.Version(); err != nil {
+			t.Fatalf("get version: %v", err)
+		} else if cur != to {
+			t.Fatalf("dry run migrate down from %d changed version to %d", to, cur)
+		}
+		if err := db.MigrateDown(context.Background(), floor); err != nil {
+			t.Fatalf("migrate down from %d to %d: %v", to, floor, err)
 		}
 		if err := db.MigrateUp(context.Background(), to); err != nil {
 			t.Fatalf("migrate up to %d again: %v", to, err)
 		}
-		if err := db.MigrateDown(context.Background(), 0); err != nil {
-			t.Fatalf("migrate down from %d to 0 again: %v", to, err)
+		if err := db.MigrateDown(context.Background(), floor); err != nil {
+			t.Fatalf("migrate down from %d to %d again: %v", to, floor, err)
 		}
 	}
 }
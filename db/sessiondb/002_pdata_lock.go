@@ -9,7 +9,7 @@ import (
 )
 
 func init() {
-	migrate(up002, down002)
+	migrations.Add(up002, down002)
 }
 
 func up002(ctx context.Context, tx *sqlx.Tx) error {
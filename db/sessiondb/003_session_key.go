@@ -0,0 +1,30 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	migrations.Add(up003, down003)
+}
+
+func up003(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session ADD COLUMN session_key TEXT; -- opaque udp signing key for clients
+	`); err != nil {
+		return fmt.Errorf("add columns: %w", err)
+	}
+	return nil
+}
+
+func down003(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session DROP COLUMN session_key;
+	`); err != nil {
+		return fmt.Errorf("drop columns: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	migrations.Add(up004, down004)
+}
+
+func up004(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session ADD COLUMN session_player_uid INTEGER; -- last player verified by the session (the player_session may have since been replaced)
+	`); err != nil {
+		return fmt.Errorf("add columns: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		CREATE INDEX player_session_session_idx ON player_session (session_id); -- used for cleanup
+	`); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+	return nil
+}
+
+func down004(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		DROP INDEX player_session_session_idx;
+	`); err != nil {
+		return fmt.Errorf("drop indexes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session DROP COLUMN session_player_uid;
+	`); err != nil {
+		return fmt.Errorf("drop columns: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	migrations.Add(up005, down005)
+}
+
+func up005(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session ADD COLUMN session_server_addr TEXT; -- last server verified by the session (the server_session may have since been replaced)
+	`); err != nil {
+		return fmt.Errorf("add columns: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		CREATE INDEX server_session_session_idx ON server_session (session_id); -- used for cleanup
+	`); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+	return nil
+}
+
+func down005(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		DROP INDEX server_session_session_idx;
+	`); err != nil {
+		return fmt.Errorf("drop indexes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		ALTER TABLE session DROP COLUMN session_server_addr;
+	`); err != nil {
+		return fmt.Errorf("drop columns: %w", err)
+	}
+	return nil
+}
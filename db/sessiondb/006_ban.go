@@ -0,0 +1,57 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	migrations.Add(up006, down006)
+}
+
+func up006(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, strings.ReplaceAll(`
+		CREATE TABLE ban (
+			ban_id INTEGER PRIMARY KEY,
+			ban_player_uid INTEGER, -- banned player, if not null
+			ban_ip TEXT, -- banned ip prefix, if not null
+			ban_ip_first BLOB, -- first ip in ban_ip as 16 bytes (ipv4 is mapped to ipv6)
+			ban_ip_last BLOB, -- last ip in ban_ip as 16 bytes (ipv4 is mapped to ipv6)
+			ban_server_addr TEXT, -- banned server ip/port, if not null
+			ban_reason TEXT NOT NULL, -- shown to the client
+			ban_created INTEGER NOT NULL, -- unix timestamp
+			ban_expires INTEGER -- unix timestamp, null if permanent
+		) STRICT;
+	`, `
+		`, "\n")); err != nil {
+		return fmt.Errorf("create tables: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, strings.ReplaceAll(`
+		CREATE INDEX ban_player_uid_idx ON ban (ban_player_uid); -- used for lookup
+		CREATE INDEX ban_ip_idx ON ban (ban_ip_first, ban_ip_last); -- used for lookup
+		CREATE INDEX ban_server_addr_idx ON ban (ban_server_addr); -- used for lookup
+	`, `
+		`, "\n")); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+	return nil
+}
+
+func down006(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `
+		DROP INDEX ban_player_uid_idx;
+		DROP INDEX ban_ip_idx;
+		DROP INDEX ban_server_addr_idx;
+	`); err != nil {
+		return fmt.Errorf("drop indexes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DROP TABLE ban;
+	`); err != nil {
+		return fmt.Errorf("drop tables: %w", err)
+	}
+	return nil
+}
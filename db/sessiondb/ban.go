@@ -0,0 +1,214 @@
+package sessiondb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Ban prevents a player, ip range, or server address from using the master
+// server. Exactly one of UID, IP, and Server is set.
+type Ban struct {
+	ID      int64
+	UID     uint64         // banned player, if nonzero
+	IP      netip.Prefix   // banned ip range, if valid
+	Server  netip.AddrPort // banned server address, if valid
+	Reason  string
+	Created time.Time
+	Expires time.Time // zero if permanent
+}
+
+// Expired checks whether the ban has expired at t.
+func (b Ban) Expired(t time.Time) bool {
+	return !b.Expires.IsZero() && !t.Before(b.Expires)
+}
+
+type banRow struct {
+	ID         int64          `db:"ban_id"`
+	PlayerUID  sql.NullInt64  `db:"ban_player_uid"`
+	IP         sql.NullString `db:"ban_ip"`
+	ServerAddr sql.NullString `db:"ban_server_addr"`
+	Reason     string         `db:"ban_reason"`
+	Created    int64          `db:"ban_created"`
+	Expires    sql.NullInt64  `db:"ban_expires"`
+}
+
+const banColumns = `ban_id, ban_player_uid, ban_ip, ban_server_addr, ban_reason, ban_created, ban_expires`
+
+func (r banRow) Ban() Ban {
+	b := Ban{
+		ID:      r.ID,
+		UID:     uint64(r.PlayerUID.Int64),
+		Reason:  r.Reason,
+		Created: time.Unix(r.Created, 0),
+	}
+	if r.IP.Valid {
+		b.IP, _ = netip.ParsePrefix(r.IP.String)
+	}
+	if r.ServerAddr.Valid {
+		b.Server, _ = netip.ParseAddrPort(r.ServerAddr.String)
+	}
+	if r.Expires.Valid {
+		b.Expires = time.Unix(r.Expires.Int64, 0)
+	}
+	return b
+}
+
+// banIP converts ip to the form used for ban lookups.
+func banIP(ip netip.Addr) []byte {
+	b := ip.As16()
+	return b[:]
+}
+
+// banIPRange gets the first and last addresses in p.
+func banIPRange(p netip.Prefix) (first, last []byte) {
+	p = p.Masked()
+	b := p.Addr().As16()
+	first = append([]byte(nil), b[:]...)
+
+	bits := p.Bits()
+	if p.Addr().Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	last = b[:]
+	return first, last
+}
+
+// AddBan adds a ban. The ID and Created fields are ignored and set on the
+// returned ban.
+func (db *DB) AddBan(ctx context.Context, b Ban) (Ban, error) {
+	var (
+		uid     sql.NullInt64
+		ip      sql.NullString
+		first   []byte
+		last    []byte
+		server  sql.NullString
+		expires sql.NullInt64
+		n       int
+	)
+	if b.UID != 0 {
+		uid = sql.NullInt64{Int64: int64(b.UID), Valid: true}
+		n++
+	}
+	if b.IP.IsValid() {
+		addr, bits := b.IP.Addr().WithZone(""), b.IP.Bits()
+		if addr.Is4In6() {
+			if bits < 96 {
+				return Ban{}, fmt.Errorf("invalid ipv4-mapped ip prefix")
+			}
+			addr, bits = addr.Unmap(), bits-96
+		}
+		b.IP = netip.PrefixFrom(addr, bits).Masked()
+		ip = sql.NullString{String: b.IP.String(), Valid: true}
+		first, last = banIPRange(b.IP)
+		n++
+	}
+	if b.Server.IsValid() {
+		b.Server = netip.AddrPortFrom(b.Server.Addr().Unmap().WithZone(""), b.Server.Port())
+		server = sql.NullString{String: b.Server.String(), Valid: true}
+		n++
+	}
+	if n != 1 {
+		return Ban{}, fmt.Errorf("exactly one of the player uid, ip prefix, or server address must be set")
+	}
+	if b.Reason == "" {
+		return Ban{}, fmt.Errorf("reason must not be empty")
+	}
+	if !b.Expires.IsZero() {
+		b.Expires = time.Unix(b.Expires.Unix(), 0)
+		expires = sql.NullInt64{Int64: b.Expires.Unix(), Valid: true}
+	}
+	b.Created = time.Unix(time.Now().Unix(), 0)
+
+	res, err := db.x.ExecContext(ctx, `
+		INSERT INTO
+		ban    (ban_player_uid, ban_ip, ban_ip_first, ban_ip_last, ban_server_addr, ban_reason, ban_created, ban_expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, uid, ip, first, last, server, b.Reason, b.Created.Unix(), expires)
+	if err != nil {
+		return Ban{}, err
+	}
+	if b.ID, err = res.LastInsertId(); err != nil {
+		return Ban{}, err
+	}
+	return b, nil
+}
+
+// GetBans gets all bans, optionally including expired ones, ordered by id.
+func (db *DB) GetBans(ctx context.Context, expired bool) ([]Ban, error) {
+	var rows []banRow
+	if err := db.x.SelectContext(ctx, &rows, `
+		SELECT `+banColumns+` FROM ban
+		WHERE ? OR ban_expires IS NULL OR ban_expires > ?
+		ORDER BY ban_id
+	`, expired, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	bans := make([]Ban, len(rows))
+	for i, r := range rows {
+		bans[i] = r.Ban()
+	}
+	return bans, nil
+}
+
+// DeleteBan deletes a ban, returning whether it existed.
+func (db *DB) DeleteBan(ctx context.Context, id int64) (bool, error) {
+	res, err := db.x.ExecContext(ctx, `
+		DELETE FROM ban WHERE ban_id = ?
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
+
+// FindBan finds an active ban for the player uid, ip, or server address,
+// ignoring zero or invalid values. If there are multiple, the one which
+// expires last is returned.
+func (db *DB) FindBan(ctx context.Context, uid uint64, ip netip.Addr, server netip.AddrPort) (ban Ban, exists bool, err error) {
+	var (
+		uidArg    sql.NullInt64
+		ipArg     any // []byte
+		serverArg sql.NullString
+	)
+	if uid != 0 {
+		uidArg = sql.NullInt64{Int64: int64(uid), Valid: true}
+	}
+	if ip.IsValid() {
+		ipArg = banIP(ip.Unmap().WithZone(""))
+	}
+	if server.IsValid() {
+		serverArg = sql.NullString{String: netip.AddrPortFrom(server.Addr().Unmap().WithZone(""), server.Port()).String(), Valid: true}
+	}
+	if !uidArg.Valid && ipArg == nil && !serverArg.Valid {
+		return ban, false, nil
+	}
+
+	var row banRow
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT `+banColumns+` FROM ban
+		WHERE (ban_expires IS NULL OR ban_expires > ?) AND (
+			ban_player_uid = ? OR
+			(ban_ip_first <= ? AND ban_ip_last >= ?) OR
+			ban_server_addr = ?
+		)
+		ORDER BY ban_expires IS NULL DESC, ban_expires DESC, ban_id
+		LIMIT 1
+	`, time.Now().Unix(), uidArg, ipArg, ipArg, serverArg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ban, false, nil
+		}
+		return ban, false, err
+	}
+	return row.Ban(), true, nil
+}
@@ -0,0 +1,129 @@
+package sessiondb
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestBan(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, b := range []Ban{
+		{},
+		{UID: 1},
+		{UID: 1, IP: netip.MustParsePrefix("1.2.3.4/32"), Reason: "x"},
+		{IP: netip.MustParsePrefix("::ffff:1.2.3.4/80"), Reason: "x"},
+	} {
+		if _, err := db.AddBan(ctx, b); err == nil {
+			t.Errorf("expected error adding invalid ban %+v", b)
+		}
+	}
+
+	var (
+		past   = time.Now().Add(-time.Hour)
+		future = time.Now().Add(time.Hour)
+	)
+	for _, b := range []Ban{
+		{UID: 1, Reason: "uid"},
+		{UID: 2, Reason: "uid expired", Expires: past},
+		{UID: 3, Reason: "uid temporary", Expires: future},
+		{IP: netip.MustParsePrefix("10.1.2.3/16"), Reason: "ipv4 range"},
+		{IP: netip.MustParsePrefix("2001:db8::/32"), Reason: "ipv6 range"},
+		{IP: netip.MustParsePrefix("::ffff:192.0.2.1/128"), Reason: "ipv4 mapped"},
+		{Server: netip.MustParseAddrPort("192.0.2.2:37015"), Reason: "server"},
+		{Server: netip.MustParseAddrPort("192.0.2.3:37015"), Reason: "server expired", Expires: past},
+	} {
+		if _, err := db.AddBan(ctx, b); err != nil {
+			t.Fatalf("add ban %+v: %v", b, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		Name   string
+		UID    uint64
+		IP     string
+		Server string
+		Reason string // empty if not banned
+	}{
+		{Name: "None"},
+		{Name: "UID", UID: 1, Reason: "uid"},
+		{Name: "UIDExpired", UID: 2},
+		{Name: "UIDTemporary", UID: 3, Reason: "uid temporary"},
+		{Name: "UIDOther", UID: 4},
+		{Name: "IPv4First", IP: "10.1.0.0", Reason: "ipv4 range"},
+		{Name: "IPv4Last", IP: "10.1.255.255", Reason: "ipv4 range"},
+		{Name: "IPv4Before", IP: "10.0.255.255"},
+		{Name: "IPv4After", IP: "10.2.0.0"},
+		{Name: "IPv4Mapped", IP: "::ffff:10.1.2.3", Reason: "ipv4 range"},
+		{Name: "IPv4Single", IP: "192.0.2.1", Reason: "ipv4 mapped"},
+		{Name: "IPv6", IP: "2001:db8:ffff::1", Reason: "ipv6 range"},
+		{Name: "IPv6Other", IP: "2001:db9::1"},
+		{Name: "Server", Server: "192.0.2.2:37015", Reason: "server"},
+		{Name: "ServerOtherPort", Server: "192.0.2.2:37016"},
+		{Name: "ServerExpired", Server: "192.0.2.3:37015"},
+		{Name: "ServerIP", IP: "192.0.2.1", Server: "192.0.2.1:37015", Reason: "ipv4 mapped"},
+		{Name: "Permanent", UID: 3, IP: "10.1.2.3", Reason: "ipv4 range"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				ip     netip.Addr
+				server netip.AddrPort
+			)
+			if tc.IP != "" {
+				ip = netip.MustParseAddr(tc.IP)
+			}
+			if tc.Server != "" {
+				server = netip.MustParseAddrPort(tc.Server)
+			}
+			ban, exists, err := db.FindBan(ctx, tc.UID, ip, server)
+			if err != nil {
+				t.Fatalf("find ban: %v", err)
+			}
+			if tc.Reason == "" {
+				if exists {
+					t.Errorf("expected no ban, got %+v", ban)
+				}
+			} else if !exists {
+				t.Errorf("expected ban %q, got none", tc.Reason)
+			} else if ban.Reason != tc.Reason {
+				t.Errorf("expected ban %q, got %q", tc.Reason, ban.Reason)
+			}
+		})
+	}
+
+	if bans, err := db.GetBans(ctx, false); err != nil {
+		t.Fatalf("get bans: %v", err)
+	} else if len(bans) != 6 {
+		t.Errorf("expected 6 active bans, got %d", len(bans))
+	} else if bans[2].IP.String() != "10.1.0.0/16" {
+		t.Errorf("expected ip prefix to be masked, got %s", bans[2].IP)
+	} else if bans[3].IP.String() != "2001:db8::/32" {
+		t.Errorf("expected ipv6 prefix, got %s", bans[3].IP)
+	}
+
+	bans, err := db.GetBans(ctx, true)
+	if err != nil {
+		t.Fatalf("get bans: %v", err)
+	} else if len(bans) != 8 {
+		t.Fatalf("expected 8 bans, got %d", len(bans))
+	}
+
+	if ok, err := db.DeleteBan(ctx, bans[0].ID); err != nil {
+		t.Fatalf("delete ban: %v", err)
+	} else if !ok {
+		t.Errorf("expected ban to be deleted")
+	}
+	if ok, err := db.DeleteBan(ctx, bans[0].ID); err != nil {
+		t.Fatalf("delete ban: %v", err)
+	} else if ok {
+		t.Errorf("expected ban to already be deleted")
+	}
+	if _, exists, err := db.FindBan(ctx, 1, netip.Addr{}, netip.AddrPort{}); err != nil {
+		t.Fatalf("find ban: %v", err)
+	} else if exists {
+		t.Errorf("ban still exists after delete")
+	}
+}
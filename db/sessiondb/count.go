@@ -0,0 +1,36 @@
+package sessiondb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CountResult contains the number of rows returned by [DB.Count].
+type CountResult struct {
+	Sessions       int64
+	PlayerSessions int64
+	ServerSessions int64
+	PdataLocks     int64
+}
+
+// Count counts sessions, player sessions, server sessions, and pdata locks.
+// Expired rows which have not been swept yet are included.
+func (db *DB) Count(ctx context.Context) (CountResult, error) {
+	var res CountResult
+	if err := db.x.QueryRowxContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM session),
+			(SELECT COUNT(*) FROM player_session),
+			(SELECT COUNT(*) FROM server_session),
+			(SELECT COUNT(*) FROM pdata_lock)
+	`).Scan(&res.Sessions, &res.PlayerSessions, &res.ServerSessions, &res.PdataLocks); err != nil {
+		return res, fmt.Errorf("count rows: %w", err)
+	}
+	return res, nil
+}
+
+// DBStats returns database connection pool statistics.
+func (db *DB) DBStats() sql.DBStats {
+	return db.x.Stats()
+}
@@ -2,35 +2,33 @@
 package sessiondb
 
 import (
-	"net/url"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/r2northstar/atlas/v2/db/sqlite"
 )
 
 // DB stores player data in a sqlite3 database.
 type DB struct {
-	x *sqlx.DB
+	x  *sqlx.DB
+	ro bool
 }
 
+// Options contains sqlite3 tuning options. Zero values use the defaults, and
+// the busy timeout defaults to 3s.
+type Options = sqlite.Options
+
 // Open opens a DB from the provided sqlite3 uri.
-func Open(name string) (*DB, error) {
-	x, err := sqlx.Connect("sqlite3", (&url.URL{
-		Path: name,
-		RawQuery: (url.Values{
-			"_journal":      {"WAL"},
-			"_synchronous":  {"NORMAL"},
-			"_busy_timeout": {"3000"},
-			"_cache_size":   {"-16000"},
-		}).Encode(),
-	}).String())
+func Open(name string, opt Options) (*DB, error) {
+	x, err := sqlite.Open(name, opt, time.Second*3)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{x: x}, nil
+	return &DB{x: x, ro: opt.ReadOnly}, nil
 }
 
+// Close checkpoints the write-ahead log (unless the database is read-only) and
+// closes the database.
 func (db *DB) Close() error {
-	return db.x.Close()
+	return sqlite.Close(db.x, db.ro)
 }
-
-// TODO
@@ -0,0 +1,102 @@
+package sessiondb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PdataLock is a pdata write lock for a player.
+type PdataLock struct {
+	UID     uint64
+	Token   string // opaque lock token for clients
+	Desc    string // human-readable description of what locked the pdata
+	Created time.Time
+}
+
+// GetPdataLock gets the current pdata lock for the player.
+func (db *DB) GetPdataLock(ctx context.Context, uid uint64) (lock PdataLock, exists bool, err error) {
+	var row struct {
+		UID     int64          `db:"player_uid"`
+		Token   sql.NullString `db:"pdata_lock_token"`
+		Desc    sql.NullString `db:"pdata_lock_desc"`
+		Created int64          `db:"pdata_lock_created"`
+	}
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT player_uid, pdata_lock_token, pdata_lock_desc, pdata_lock_created
+		FROM pdata_lock WHERE player_uid = ?
+	`, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return lock, false, nil
+		}
+		return lock, false, err
+	}
+	return PdataLock{
+		UID:     uint64(row.UID),
+		Token:   row.Token.String,
+		Desc:    row.Desc.String,
+		Created: time.Unix(row.Created, 0),
+	}, true, nil
+}
+
+// SetPdataLock replaces the pdata lock for the player.
+func (db *DB) SetPdataLock(ctx context.Context, uid uint64, token, desc string) (PdataLock, error) {
+	if token == "" {
+		return PdataLock{}, fmt.Errorf("lock token must not be empty")
+	}
+	lock := PdataLock{
+		UID:     uid,
+		Token:   token,
+		Desc:    desc,
+		Created: time.Unix(time.Now().Unix(), 0),
+	}
+	if _, err := db.x.ExecContext(ctx, `
+		INSERT OR REPLACE INTO
+		pdata_lock (player_uid, pdata_lock_token, pdata_lock_desc, pdata_lock_created)
+		VALUES     (?, ?, ?, ?)
+	`, uid, lock.Token, lock.Desc, lock.Created.Unix()); err != nil {
+		return PdataLock{}, err
+	}
+	return lock, nil
+}
+
+// ClearPdataLock removes the pdata lock for the player. If token is not empty,
+// the lock is only removed if it matches. It returns whether a lock was
+// removed.
+func (db *DB) ClearPdataLock(ctx context.Context, uid uint64, token string) (bool, error) {
+	var (
+		res sql.Result
+		err error
+	)
+	if token == "" {
+		res, err = db.x.ExecContext(ctx, `
+			DELETE FROM pdata_lock WHERE player_uid = ?
+		`, uid)
+	} else {
+		res, err = db.x.ExecContext(ctx, `
+			DELETE FROM pdata_lock WHERE player_uid = ? AND pdata_lock_token = ?
+		`, uid, token)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
+
+// SweepPdataLocks removes pdata locks created before the provided time,
+// returning the number of locks removed.
+func (db *DB) SweepPdataLocks(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.x.ExecContext(ctx, `
+		DELETE FROM pdata_lock WHERE pdata_lock_created < ?
+	`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package sessiondb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPdataLock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	if _, exists, err := db.GetPdataLock(ctx, 1); err != nil {
+		t.Fatalf("get pdata lock: %v", err)
+	} else if exists {
+		t.Fatalf("pdata lock exists before being set")
+	}
+
+	for _, tc := range []struct {
+		Name    string
+		Set     string // token to set, if not empty
+		Clear   string // token to clear with, if Set is empty
+		Cleared bool
+		Current string // expected token after, empty if none
+	}{
+		{Name: "Set", Set: "a", Current: "a"},
+		{Name: "Replace", Set: "b", Current: "b"},
+		{Name: "ClearWrong", Clear: "a", Cleared: false, Current: "b"},
+		{Name: "ClearToken", Clear: "b", Cleared: true, Current: ""},
+		{Name: "ClearNone", Clear: "", Cleared: false, Current: ""},
+		{Name: "SetAgain", Set: "c", Current: "c"},
+		{Name: "ClearAny", Clear: "", Cleared: true, Current: ""},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			if tc.Set != "" {
+				if lock, err := db.SetPdataLock(ctx, 1, tc.Set, "desc "+tc.Set); err != nil {
+					t.Fatalf("set pdata lock: %v", err)
+				} else if lock.UID != 1 || lock.Token != tc.Set || lock.Desc != "desc "+tc.Set {
+					t.Errorf("incorrect pdata lock %+v", lock)
+				}
+			} else {
+				if ok, err := db.ClearPdataLock(ctx, 1, tc.Clear); err != nil {
+					t.Fatalf("clear pdata lock: %v", err)
+				} else if ok != tc.Cleared {
+					t.Errorf("expected cleared=%t, got %t", tc.Cleared, ok)
+				}
+			}
+			lock, exists, err := db.GetPdataLock(ctx, 1)
+			if err != nil {
+				t.Fatalf("get pdata lock: %v", err)
+			}
+			if tc.Current == "" {
+				if exists {
+					t.Errorf("expected no lock, got %+v", lock)
+				}
+			} else if !exists {
+				t.Errorf("expected lock %q, got none", tc.Current)
+			} else if lock.Token != tc.Current {
+				t.Errorf("expected lock %q, got %q", tc.Current, lock.Token)
+			}
+		})
+	}
+
+	if _, exists, err := db.GetPdataLock(ctx, 2); err != nil {
+		t.Fatalf("get pdata lock: %v", err)
+	} else if exists {
+		t.Errorf("pdata lock exists for another player")
+	}
+}
+
+func TestSweepPdataLocks(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for uid := uint64(1); uid <= 2; uid++ {
+		if _, err := db.SetPdataLock(ctx, uid, "token", "desc"); err != nil {
+			t.Fatalf("set pdata lock: %v", err)
+		}
+	}
+
+	if n, err := db.SweepPdataLocks(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("sweep pdata locks: %v", err)
+	} else if n != 0 {
+		t.Errorf("expected no locks to be swept, got %d", n)
+	}
+
+	if n, err := db.SweepPdataLocks(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("sweep pdata locks: %v", err)
+	} else if n != 2 {
+		t.Errorf("expected 2 locks to be swept, got %d", n)
+	}
+
+	if _, exists, err := db.GetPdataLock(ctx, 1); err != nil {
+		t.Fatalf("get pdata lock: %v", err)
+	} else if exists {
+		t.Errorf("pdata lock still exists after sweep")
+	}
+}
@@ -0,0 +1,396 @@
+package sessiondb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Session contains information about a client session.
+type Session struct {
+	ID         int64
+	Token      string // opaque token used by the client to identify the session
+	Key        string // opaque key used to sign udp packets sent to the client
+	Created    time.Time
+	Used       time.Time
+	Data       json.RawMessage // from when the session was created
+	PlayerUID  uint64          // last player verified by the session, if non-zero
+	ServerAddr netip.AddrPort  // last server verified by the session, if valid
+}
+
+type sessionRow struct {
+	ID         int64          `db:"session_id"`
+	Token      string         `db:"session_token"`
+	Key        sql.NullString `db:"session_key"`
+	Created    int64          `db:"session_created"`
+	Used       int64          `db:"session_used"`
+	Data       sql.NullString `db:"session_data"`
+	PlayerUID  sql.NullInt64  `db:"session_player_uid"`
+	ServerAddr sql.NullString `db:"session_server_addr"`
+}
+
+const sessionColumns = `session_id, session_token, session_key, session_created, session_used, session_data, session_player_uid, session_server_addr`
+
+func (r sessionRow) Session() Session {
+	s := Session{
+		ID:        r.ID,
+		Token:     r.Token,
+		Key:       r.Key.String,
+		Created:   time.Unix(r.Created, 0),
+		Used:      time.Unix(r.Used, 0),
+		PlayerUID: uint64(r.PlayerUID.Int64),
+	}
+	if r.Data.Valid {
+		s.Data = json.RawMessage(r.Data.String)
+	}
+	if r.ServerAddr.Valid {
+		s.ServerAddr, _ = netip.ParseAddrPort(r.ServerAddr.String)
+	}
+	return s
+}
+
+// CreateSession creates a new session with the provided token and key, which
+// must be unique.
+func (db *DB) CreateSession(ctx context.Context, token, key string, data json.RawMessage) (Session, error) {
+	if token == "" {
+		return Session{}, fmt.Errorf("session token must not be empty")
+	}
+	if data != nil && !json.Valid(data) {
+		return Session{}, fmt.Errorf("session data is not valid json")
+	}
+
+	now := time.Now().Unix()
+	row := sessionRow{
+		Token:   token,
+		Key:     sql.NullString{String: key, Valid: true},
+		Created: now,
+		Used:    now,
+		Data:    sql.NullString{String: string(data), Valid: data != nil},
+	}
+
+	res, err := db.x.NamedExecContext(ctx, `
+		INSERT INTO
+		session ( session_token,  session_key,  session_created,  session_used,  session_data)
+		VALUES  (:session_token, :session_key, :session_created, :session_used, :session_data)
+	`, row)
+	if err != nil {
+		return Session{}, err
+	}
+	if row.ID, err = res.LastInsertId(); err != nil {
+		return Session{}, fmt.Errorf("get session id: %w", err)
+	}
+	return row.Session(), nil
+}
+
+// GetSession gets the session with the provided token.
+func (db *DB) GetSession(ctx context.Context, token string) (sess Session, exists bool, err error) {
+	var row sessionRow
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT `+sessionColumns+`
+		FROM session WHERE session_token = ?
+	`, token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sess, false, nil
+		}
+		return sess, false, err
+	}
+	return row.Session(), true, nil
+}
+
+// GetSessionByID gets the session with the provided ID.
+func (db *DB) GetSessionByID(ctx context.Context, sessionID int64) (sess Session, exists bool, err error) {
+	var row sessionRow
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT `+sessionColumns+`
+		FROM session WHERE session_id = ?
+	`, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sess, false, nil
+		}
+		return sess, false, err
+	}
+	return row.Session(), true, nil
+}
+
+// ListSessions gets all sessions used at or after the provided time, ordered
+// by ID.
+func (db *DB) ListSessions(ctx context.Context, usedSince time.Time) ([]Session, error) {
+	var rows []sessionRow
+	if err := db.x.SelectContext(ctx, &rows, `
+		SELECT `+sessionColumns+`
+		FROM session WHERE session_used >= ? ORDER BY session_id
+	`, usedSince.Unix()); err != nil {
+		return nil, err
+	}
+	ss := make([]Session, len(rows))
+	for i, row := range rows {
+		ss[i] = row.Session()
+	}
+	return ss, nil
+}
+
+// TouchSession updates the last used time of the session.
+func (db *DB) TouchSession(ctx context.Context, sessionID int64) error {
+	if _, err := db.x.ExecContext(ctx, `
+		UPDATE session SET session_used = ? WHERE session_id = ?
+	`, time.Now().Unix(), sessionID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PlayerSession associates a player with the session which most recently
+// verified it.
+type PlayerSession struct {
+	UID       uint64
+	Created   time.Time
+	SessionID int64
+}
+
+// GetPlayerSession gets the session which most recently verified the player.
+func (db *DB) GetPlayerSession(ctx context.Context, uid uint64) (ps PlayerSession, exists bool, err error) {
+	var row struct {
+		UID       int64 `db:"player_uid"`
+		Created   int64 `db:"player_session_created"`
+		SessionID int64 `db:"session_id"`
+	}
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT player_uid, player_session_created, session_id
+		FROM player_session WHERE player_uid = ?
+	`, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ps, false, nil
+		}
+		return ps, false, err
+	}
+	return PlayerSession{
+		UID:       uint64(row.UID),
+		Created:   time.Unix(row.Created, 0),
+		SessionID: row.SessionID,
+	}, true, nil
+}
+
+// ClearPlayerSession unbinds the player from the session, if it is still the
+// current session for the player.
+func (db *DB) ClearPlayerSession(ctx context.Context, sessionID int64) error {
+	tx, err := db.x.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE session SET session_player_uid = NULL WHERE session_id = ?
+	`, sessionID); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM player_session WHERE session_id = ?
+	`, sessionID); err != nil {
+		return fmt.Errorf("delete player session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetPlayerSession binds the verified player uid to the session, replacing any
+// existing session for the player. If username is not empty, the last known
+// username for the player is updated.
+func (db *DB) SetPlayerSession(ctx context.Context, sessionID int64, uid uint64, username string) error {
+	if uid == 0 {
+		return fmt.Errorf("player uid must not be zero")
+	}
+
+	tx, err := db.x.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if res, err := tx.ExecContext(ctx, `
+		UPDATE session SET session_player_uid = ? WHERE session_id = ?
+	`, uid, sessionID); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("update session: session %d does not exist", sessionID)
+	}
+
+	// a session can only verify one player at a time
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM player_session WHERE session_id = ? AND player_uid != ?
+	`, sessionID, uid); err != nil {
+		return fmt.Errorf("delete old player session: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO
+		player_session (player_uid, player_session_created, session_id)
+		VALUES         (?, ?, ?)
+	`, uid, time.Now().Unix(), sessionID); err != nil {
+		return fmt.Errorf("update player session: %w", err)
+	}
+
+	if username != "" {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO
+			player_username (player_uid, player_username)
+			VALUES          (?, ?)
+		`, uid, username); err != nil {
+			return fmt.Errorf("update player username: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ServerSession associates a server address with the session which most
+// recently verified it.
+type ServerSession struct {
+	Addr      netip.AddrPort
+	Created   time.Time
+	SessionID int64
+}
+
+// GetServerSession gets the session which most recently verified the server.
+func (db *DB) GetServerSession(ctx context.Context, addr netip.AddrPort) (ss ServerSession, exists bool, err error) {
+	var row struct {
+		Addr      string `db:"server_addr"`
+		Created   int64  `db:"server_session_created"`
+		SessionID int64  `db:"session_id"`
+	}
+	if err := db.x.GetContext(ctx, &row, `
+		SELECT server_addr, server_session_created, session_id
+		FROM server_session WHERE server_addr = ?
+	`, canonicalAddr(addr)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ss, false, nil
+		}
+		return ss, false, err
+	}
+	a, err := netip.ParseAddrPort(row.Addr)
+	if err != nil {
+		return ss, false, fmt.Errorf("invalid server address %q: %w", row.Addr, err)
+	}
+	return ServerSession{
+		Addr:      a,
+		Created:   time.Unix(row.Created, 0),
+		SessionID: row.SessionID,
+	}, true, nil
+}
+
+// SetServerSession binds the verified server address to the session, replacing
+// any existing session for the server.
+func (db *DB) SetServerSession(ctx context.Context, sessionID int64, addr netip.AddrPort) error {
+	if !addr.IsValid() {
+		return fmt.Errorf("server address must be valid")
+	}
+	sa := canonicalAddr(addr)
+
+	tx, err := db.x.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if res, err := tx.ExecContext(ctx, `
+		UPDATE session SET session_server_addr = ? WHERE session_id = ?
+	`, sa, sessionID); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("update session: session %d does not exist", sessionID)
+	}
+
+	// a session can only verify one server at a time
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM server_session WHERE session_id = ? AND server_addr != ?
+	`, sessionID, sa); err != nil {
+		return fmt.Errorf("delete old server session: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO
+		server_session (server_addr, server_session_created, session_id)
+		VALUES         (?, ?, ?)
+	`, sa, time.Now().Unix(), sessionID); err != nil {
+		return fmt.Errorf("update server session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ClearServerSession unbinds the server from the session, if it is still the
+// current session for the server.
+func (db *DB) ClearServerSession(ctx context.Context, sessionID int64) error {
+	tx, err := db.x.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE session SET session_server_addr = NULL WHERE session_id = ?
+	`, sessionID); err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM server_session WHERE session_id = ?
+	`, sessionID); err != nil {
+		return fmt.Errorf("delete server session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetPlayerUsername gets the last known username for the player.
+func (db *DB) GetPlayerUsername(ctx context.Context, uid uint64) (username string, exists bool, err error) {
+	if err := db.x.GetContext(ctx, &username, `
+		SELECT player_username FROM player_username WHERE player_uid = ?
+	`, uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return username, true, nil
+}
+
+// GetPlayerUIDs gets the players whose last known username is username,
+// ordered by uid. Usernames are case-sensitive.
+func (db *DB) GetPlayerUIDs(ctx context.Context, username string) ([]uint64, error) {
+	var uids []int64
+	if err := db.x.SelectContext(ctx, &uids, `
+		SELECT player_uid FROM player_username WHERE player_username = ? ORDER BY player_uid
+	`, username); err != nil {
+		return nil, err
+	}
+	r := make([]uint64, len(uids))
+	for i, uid := range uids {
+		r[i] = uint64(uid)
+	}
+	return r, nil
+}
+
+// canonicalAddr formats addr as a canonical non-expanded ip:port.
+func canonicalAddr(addr netip.AddrPort) string {
+	return netip.AddrPortFrom(addr.Addr().Unmap().WithZone(""), addr.Port()).String()
+}
@@ -0,0 +1,394 @@
+package sessiondb
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *DB {
+	db, err := Open(filepath.Join(t.TempDir(), "session.db"), Options{})
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, to, err := db.Version()
+	if err != nil {
+		panic(err)
+	}
+	if err := db.MigrateUp(context.Background(), to); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for _, tc := range []struct {
+		Name  string
+		Token string
+		Key   string
+		Data  json.RawMessage
+		Err   bool
+	}{
+		{Name: "Simple", Token: "token1", Key: "key1"},
+		{Name: "Data", Token: "token2", Key: "key2", Data: json.RawMessage(`{"a":"b"}`)},
+		{Name: "NoKey", Token: "token3"},
+		{Name: "EmptyToken", Token: "", Key: "key4", Err: true},
+		{Name: "InvalidData", Token: "token5", Key: "key5", Data: json.RawMessage(`{`), Err: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			sess, err := db.CreateSession(ctx, tc.Token, tc.Key, tc.Data)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			if sess.ID == 0 || sess.Token != tc.Token || sess.Key != tc.Key || string(sess.Data) != string(tc.Data) {
+				t.Errorf("incorrect created session %+v", sess)
+			}
+
+			got, exists, err := db.GetSession(ctx, tc.Token)
+			if err != nil {
+				t.Fatalf("get session: %v", err)
+			}
+			if !exists {
+				t.Fatalf("session does not exist")
+			}
+			if !reflect.DeepEqual(got, sess) {
+				t.Errorf("got session %+v, expected %+v", got, sess)
+			}
+
+			got, exists, err = db.GetSessionByID(ctx, sess.ID)
+			if err != nil {
+				t.Fatalf("get session by id: %v", err)
+			}
+			if !exists {
+				t.Fatalf("session does not exist by id")
+			}
+			if !reflect.DeepEqual(got, sess) {
+				t.Errorf("got session by id %+v, expected %+v", got, sess)
+			}
+
+			if err := db.TouchSession(ctx, sess.ID); err != nil {
+				t.Fatalf("touch session: %v", err)
+			}
+		})
+	}
+
+	if _, exists, err := db.GetSession(ctx, "nonexistent"); err != nil {
+		t.Fatalf("get nonexistent session: %v", err)
+	} else if exists {
+		t.Errorf("nonexistent session exists")
+	}
+
+	if ss, err := db.ListSessions(ctx, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("list sessions: %v", err)
+	} else if len(ss) != 3 {
+		t.Errorf("expected 3 active sessions, got %d", len(ss))
+	}
+
+	if ss, err := db.ListSessions(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("list sessions: %v", err)
+	} else if len(ss) != 0 {
+		t.Errorf("expected 0 active sessions, got %d", len(ss))
+	}
+}
+
+func TestPlayerSession(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	var sessions []Session
+	for _, token := range []string{"a", "b", "c"} {
+		sess, err := db.CreateSession(ctx, token, token, nil)
+		if err != nil {
+			panic(err)
+		}
+		sessions = append(sessions, sess)
+	}
+
+	for _, tc := range []struct {
+		Name     string
+		Session  int // index
+		UID      uint64
+		Username string
+		Err      bool
+
+		// expected state after
+		Current   map[uint64]int // [uid]session index, -1 if none
+		Usernames map[uint64]string
+	}{
+		{
+			Name: "Bind", Session: 0, UID: 1, Username: "one",
+			Current:   map[uint64]int{1: 0},
+			Usernames: map[uint64]string{1: "one"},
+		},
+		{
+			Name: "Replace", Session: 1, UID: 1, Username: "uno",
+			Current:   map[uint64]int{1: 1},
+			Usernames: map[uint64]string{1: "uno"},
+		},
+		{
+			Name: "KeepUsername", Session: 1, UID: 1, Username: "",
+			Current:   map[uint64]int{1: 1},
+			Usernames: map[uint64]string{1: "uno"},
+		},
+		{
+			Name: "SwitchPlayer", Session: 1, UID: 2, Username: "two",
+			Current:   map[uint64]int{1: -1, 2: 1},
+			Usernames: map[uint64]string{1: "uno", 2: "two"},
+		},
+		{
+			Name: "ZeroUID", Session: 2, UID: 0, Err: true,
+			Current: map[uint64]int{1: -1, 2: 1},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := db.SetPlayerSession(ctx, sessions[tc.Session].ID, tc.UID, tc.Username)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("set player session: %v", err)
+				}
+				if sess, _, err := db.GetSessionByID(ctx, sessions[tc.Session].ID); err != nil {
+					t.Fatalf("get session: %v", err)
+				} else if sess.PlayerUID != tc.UID {
+					t.Errorf("expected session player uid %d, got %d", tc.UID, sess.PlayerUID)
+				}
+			}
+			for uid, idx := range tc.Current {
+				ps, exists, err := db.GetPlayerSession(ctx, uid)
+				if err != nil {
+					t.Fatalf("get player session: %v", err)
+				}
+				if idx == -1 {
+					if exists {
+						t.Errorf("uid %d: expected no session, got session %d", uid, ps.SessionID)
+					}
+				} else if !exists {
+					t.Errorf("uid %d: expected session %d, got none", uid, sessions[idx].ID)
+				} else if ps.SessionID != sessions[idx].ID {
+					t.Errorf("uid %d: expected session %d, got %d", uid, sessions[idx].ID, ps.SessionID)
+				}
+			}
+			for uid, username := range tc.Usernames {
+				if u, exists, err := db.GetPlayerUsername(ctx, uid); err != nil {
+					t.Fatalf("get player username: %v", err)
+				} else if !exists || u != username {
+					t.Errorf("uid %d: expected username %q, got %q", uid, username, u)
+				}
+				if uids, err := db.GetPlayerUIDs(ctx, username); err != nil {
+					t.Fatalf("get player uids: %v", err)
+				} else if !reflect.DeepEqual(uids, []uint64{uid}) {
+					t.Errorf("username %q: expected uids [%d], got %v", username, uid, uids)
+				}
+			}
+		})
+	}
+
+	if err := db.ClearPlayerSession(ctx, sessions[1].ID); err != nil {
+		t.Fatalf("clear player session: %v", err)
+	}
+	if _, exists, err := db.GetPlayerSession(ctx, 2); err != nil {
+		t.Fatalf("get player session: %v", err)
+	} else if exists {
+		t.Errorf("player session still exists after clear")
+	}
+	if sess, _, err := db.GetSessionByID(ctx, sessions[1].ID); err != nil {
+		t.Fatalf("get session: %v", err)
+	} else if sess.PlayerUID != 0 {
+		t.Errorf("session player uid still set after clear")
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	var sessions []Session
+	for _, token := range []string{"a", "b"} {
+		sess, err := db.CreateSession(ctx, token, token, nil)
+		if err != nil {
+			panic(err)
+		}
+		sessions = append(sessions, sess)
+	}
+
+	var (
+		addr1 = netip.MustParseAddrPort("192.0.2.1:37015")
+		addr2 = netip.MustParseAddrPort("[::ffff:192.0.2.2]:37015")
+		addr3 = netip.MustParseAddrPort("[2001:db8::1]:37015")
+	)
+	for _, tc := range []struct {
+		Name    string
+		Session int // index
+		Addr    netip.AddrPort
+		Err     bool
+
+		// expected state after
+		Current map[netip.AddrPort]int // [addr]session index, -1 if none
+	}{
+		{
+			Name: "Bind", Session: 0, Addr: addr1,
+			Current: map[netip.AddrPort]int{addr1: 0},
+		},
+		{
+			Name: "Replace", Session: 1, Addr: addr1,
+			Current: map[netip.AddrPort]int{addr1: 1},
+		},
+		{
+			Name: "Mapped", Session: 0, Addr: addr2,
+			Current: map[netip.AddrPort]int{addr1: 1, addr2: 0, netip.MustParseAddrPort("192.0.2.2:37015"): 0},
+		},
+		{
+			Name: "SwitchServer", Session: 0, Addr: addr3,
+			Current: map[netip.AddrPort]int{addr1: 1, addr2: -1, addr3: 0},
+		},
+		{
+			Name: "Invalid", Session: 0, Addr: netip.AddrPort{}, Err: true,
+			Current: map[netip.AddrPort]int{addr1: 1, addr3: 0},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := db.SetServerSession(ctx, sessions[tc.Session].ID, tc.Addr)
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("set server session: %v", err)
+				}
+				if sess, _, err := db.GetSessionByID(ctx, sessions[tc.Session].ID); err != nil {
+					t.Fatalf("get session: %v", err)
+				} else if sess.ServerAddr.String() != canonicalAddr(tc.Addr) {
+					t.Errorf("expected session server addr %s, got %s", canonicalAddr(tc.Addr), sess.ServerAddr)
+				}
+			}
+			for addr, idx := range tc.Current {
+				ss, exists, err := db.GetServerSession(ctx, addr)
+				if err != nil {
+					t.Fatalf("get server session: %v", err)
+				}
+				if idx == -1 {
+					if exists {
+						t.Errorf("addr %s: expected no session, got session %d", addr, ss.SessionID)
+					}
+				} else if !exists {
+					t.Errorf("addr %s: expected session %d, got none", addr, sessions[idx].ID)
+				} else if ss.SessionID != sessions[idx].ID {
+					t.Errorf("addr %s: expected session %d, got %d", addr, sessions[idx].ID, ss.SessionID)
+				}
+			}
+		})
+	}
+
+	if err := db.ClearServerSession(ctx, sessions[1].ID); err != nil {
+		t.Fatalf("clear server session: %v", err)
+	}
+	if _, exists, err := db.GetServerSession(ctx, addr1); err != nil {
+		t.Fatalf("get server session: %v", err)
+	} else if exists {
+		t.Errorf("server session still exists after clear")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		past   = time.Now().Add(-time.Hour)
+		future = time.Now().Add(time.Hour)
+	)
+	for _, tc := range []struct {
+		Name                                      string
+		SessionBefore, PlayerBefore, ServerBefore time.Time
+		Result                                    SweepResult
+	}{
+		{
+			Name:   "None",
+			Result: SweepResult{},
+		},
+		{
+			Name:          "NoneExpired",
+			SessionBefore: past, PlayerBefore: past, ServerBefore: past,
+			Result: SweepResult{},
+		},
+		{
+			Name:          "Sessions",
+			SessionBefore: future,
+			Result:        SweepResult{Sessions: 2, PlayerSessions: 1, ServerSessions: 1}, // orphaned
+		},
+		{
+			Name:         "PlayerSessions",
+			PlayerBefore: future,
+			Result:       SweepResult{PlayerSessions: 1},
+		},
+		{
+			Name:         "ServerSessions",
+			ServerBefore: future,
+			Result:       SweepResult{ServerSessions: 1},
+		},
+		{
+			Name:          "All",
+			SessionBefore: future, PlayerBefore: future, ServerBefore: future,
+			Result: SweepResult{Sessions: 2, PlayerSessions: 1, ServerSessions: 1},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := openTestDB(t)
+
+			s1, err := db.CreateSession(ctx, "a", "a", nil)
+			if err != nil {
+				panic(err)
+			}
+			s2, err := db.CreateSession(ctx, "b", "b", nil)
+			if err != nil {
+				panic(err)
+			}
+			if err := db.SetPlayerSession(ctx, s1.ID, 1, "one"); err != nil {
+				panic(err)
+			}
+			if err := db.SetServerSession(ctx, s2.ID, netip.MustParseAddrPort("192.0.2.1:37015")); err != nil {
+				panic(err)
+			}
+
+			res, err := db.Sweep(ctx, tc.SessionBefore, tc.PlayerBefore, tc.ServerBefore)
+			if err != nil {
+				t.Fatalf("sweep: %v", err)
+			}
+			if res != tc.Result {
+				t.Errorf("expected %+v, got %+v", tc.Result, res)
+			}
+
+			cnt, err := db.Count(ctx)
+			if err != nil {
+				t.Fatalf("count: %v", err)
+			}
+			if exp := (CountResult{
+				Sessions:       2 - tc.Result.Sessions,
+				PlayerSessions: 1 - tc.Result.PlayerSessions,
+				ServerSessions: 1 - tc.Result.ServerSessions,
+			}); cnt != exp {
+				t.Errorf("expected %+v remaining, got %+v", exp, cnt)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SweepResult contains the number of rows removed by [DB.Sweep].
+type SweepResult struct {
+	Sessions       int64
+	PlayerSessions int64
+	ServerSessions int64
+}
+
+// Sweep deletes sessions last used before sessionBefore, player sessions
+// created before playerBefore, and server sessions created before
+// serverBefore. Player and server sessions belonging to deleted sessions are
+// also removed. Zero times are ignored.
+func (db *DB) Sweep(ctx context.Context, sessionBefore, playerBefore, serverBefore time.Time) (SweepResult, error) {
+	var res SweepResult
+
+	tx, err := db.x.BeginTxx(ctx, nil)
+	if err != nil {
+		return res, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, x := range []struct {
+		Name   string
+		Query  string
+		Before time.Time
+		N      *int64
+	}{
+		{"sessions", `DELETE FROM session WHERE session_used < ?`, sessionBefore, &res.Sessions},
+		{"player sessions", `DELETE FROM player_session WHERE player_session_created < ?`, playerBefore, &res.PlayerSessions},
+		{"server sessions", `DELETE FROM server_session WHERE server_session_created < ?`, serverBefore, &res.ServerSessions},
+	} {
+		if x.Before.IsZero() {
+			continue
+		}
+		if r, err := tx.ExecContext(ctx, x.Query, x.Before.Unix()); err != nil {
+			return res, fmt.Errorf("delete expired %s: %w", x.Name, err)
+		} else if n, err := r.RowsAffected(); err != nil {
+			return res, fmt.Errorf("delete expired %s: %w", x.Name, err)
+		} else {
+			*x.N += n
+		}
+	}
+
+	for _, x := range []struct {
+		Name  string
+		Query string
+		N     *int64
+	}{
+		{"player sessions", `DELETE FROM player_session WHERE session_id NOT IN (SELECT session_id FROM session)`, &res.PlayerSessions},
+		{"server sessions", `DELETE FROM server_session WHERE session_id NOT IN (SELECT session_id FROM session)`, &res.ServerSessions},
+	} {
+		if r, err := tx.ExecContext(ctx, x.Query); err != nil {
+			return res, fmt.Errorf("delete orphaned %s: %w", x.Name, err)
+		} else if n, err := r.RowsAffected(); err != nil {
+			return res, fmt.Errorf("delete orphaned %s: %w", x.Name, err)
+		} else {
+			*x.N += n
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return res, fmt.Errorf("commit transaction: %w", err)
+	}
+	return res, nil
+}
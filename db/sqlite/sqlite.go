@@ -0,0 +1,95 @@
+// Package sqlite implements the sqlite3 connection handling shared by the
+// databases.
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Options contains sqlite3 tuning options. Zero values use the defaults.
+type Options struct {
+	BusyTimeout time.Duration // default depends on the database
+	CacheSize   int           // KiB, default 16000
+	Synchronous string        // OFF, NORMAL (default), FULL, or EXTRA
+	ReadOnly    bool          // open an existing database without writing to it
+}
+
+// Validate checks whether the options are valid.
+func (o Options) Validate() error {
+	var errs []error
+	if o.BusyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("sqlite busy timeout %s must not be negative", o.BusyTimeout))
+	}
+	if o.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("sqlite cache size %d must not be negative", o.CacheSize))
+	}
+	switch strings.ToUpper(o.Synchronous) {
+	case "", "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		errs = append(errs, fmt.Errorf("sqlite synchronous mode %q must be one of OFF, NORMAL, FULL, or EXTRA", o.Synchronous))
+	}
+	return errors.Join(errs...)
+}
+
+// URI returns the sqlite3 uri for the database file at name, using
+// busyTimeout if the busy timeout isn't set.
+func (o Options) URI(name string, busyTimeout time.Duration) (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+	if o.BusyTimeout == 0 {
+		o.BusyTimeout = busyTimeout
+	}
+	if o.CacheSize == 0 {
+		o.CacheSize = 16000
+	}
+	if o.Synchronous == "" {
+		o.Synchronous = "NORMAL"
+	}
+	q := url.Values{
+		"_busy_timeout": {strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10)},
+		"_cache_size":   {strconv.Itoa(-o.CacheSize)},
+	}
+	if o.ReadOnly {
+		// the journal mode is left alone since changing it writes to the
+		// database, and sqlite only parses the mode for file: uris
+		q.Set("mode", "ro")
+		return "file:" + (&url.URL{Path: name, RawQuery: q.Encode()}).String(), nil
+	}
+	q.Set("_journal", "WAL")
+	q.Set("_synchronous", strings.ToUpper(o.Synchronous))
+	return (&url.URL{Path: name, RawQuery: q.Encode()}).String(), nil
+}
+
+// Open opens the database file at name in WAL mode (unless it is read-only),
+// using busyTimeout if the busy timeout isn't set.
+func Open(name string, opt Options, busyTimeout time.Duration) (*sqlx.DB, error) {
+	uri, err := opt.URI(name, busyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.Connect("sqlite3", uri)
+}
+
+// Close checkpoints the write-ahead log and closes the database. If readOnly is
+// true, the log isn't checkpointed.
+func Close(x *sqlx.DB, readOnly bool) error {
+	if readOnly {
+		return x.Close()
+	}
+	_, cerr := x.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	if err := x.Close(); err != nil {
+		return err
+	}
+	if cerr != nil {
+		return fmt.Errorf("checkpoint: %w", cerr)
+	}
+	return nil
+}
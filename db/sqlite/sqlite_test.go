@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		Opt  Options
+		Fail bool
+	}{
+		{Name: "Zero", Opt: Options{}},
+		{Name: "Valid", Opt: Options{BusyTimeout: time.Second, CacheSize: 1000, Synchronous: "full"}},
+		{Name: "NegativeBusyTimeout", Opt: Options{BusyTimeout: -time.Second}, Fail: true},
+		{Name: "NegativeCacheSize", Opt: Options{CacheSize: -1}, Fail: true},
+		{Name: "InvalidSynchronous", Opt: Options{Synchronous: "SOMETIMES"}, Fail: true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			if err := tc.Opt.Validate(); tc.Fail && err == nil {
+				t.Errorf("expected error")
+			} else if !tc.Fail && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+
+	if _, err := Open(name, Options{CacheSize: -1}, time.Second); err == nil {
+		t.Fatalf("expected error for invalid options")
+	}
+
+	x, err := Open(name, Options{Synchronous: "full"}, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer Close(x, false)
+
+	for pragma, exp := range map[string]int64{
+		"busy_timeout": 1500,
+		"cache_size":   -16000,
+		"synchronous":  2, // FULL
+	} {
+		var v int64
+		if err := x.Get(&v, `PRAGMA `+pragma); err != nil {
+			t.Errorf("get %s: %v", pragma, err)
+		} else if v != exp {
+			t.Errorf("expected %s %d, got %d", pragma, exp, v)
+		}
+	}
+
+	var mode string
+	if err := x.Get(&mode, `PRAGMA journal_mode`); err != nil {
+		t.Errorf("get journal_mode: %v", err)
+	} else if mode != "wal" {
+		t.Errorf("expected journal_mode wal, got %q", mode)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+
+	if _, err := Open(name, Options{ReadOnly: true}, time.Second); err == nil {
+		t.Errorf("expected error opening a nonexistent database read-only")
+	}
+
+	x, err := Open(name, Options{}, time.Second)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := x.Exec(`CREATE TABLE t (x INTEGER)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, err := x.Exec(`INSERT INTO t VALUES (1)`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := Close(x, false); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	before, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read database: %v", err)
+	}
+
+	ro, err := Open(name, Options{ReadOnly: true}, time.Second)
+	if err != nil {
+		t.Fatalf("open read-only: %v", err)
+	}
+	var n int
+	if err := ro.Get(&n, `SELECT x FROM t`); err != nil {
+		t.Errorf("select: %v", err)
+	} else if n != 1 {
+		t.Errorf("expected 1, got %d", n)
+	}
+	if _, err := ro.Exec(`INSERT INTO t VALUES (2)`); err == nil {
+		t.Errorf("expected error writing to a read-only database")
+	}
+	if err := Close(ro, true); err != nil {
+		t.Fatalf("close read-only: %v", err)
+	}
+
+	if after, err := os.ReadFile(name); err != nil {
+		t.Fatalf("read database: %v", err)
+	} else if string(before) != string(after) {
+		t.Errorf("read-only database was modified")
+	}
+}
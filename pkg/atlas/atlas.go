@@ -1,11 +1,26 @@
 package atlas
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/pg9182/ip2x"
 	"github.com/r2northstar/atlas/v2/db/pdatadb"
 	"github.com/r2northstar/atlas/v2/db/sessiondb"
+	"github.com/r2northstar/atlas/v2/pkg/nspkt"
 )
 
 type Config struct {
@@ -17,14 +32,131 @@ type Config struct {
 
 	// SessionStorage stores authentication information.
 	SessionStorage *sessiondb.DB
+
+	// PlayerAuth verifies player identities.
+	PlayerAuth PlayerAuthenticator
+
+	// Listener, if provided, is used to send connectionless packets to game
+	// servers. It is required for server verification.
+	Listener *nspkt.Listener
+
+	// RejectInvalidPdataEnums rejects uploaded pdata containing unknown enum
+	// values.
+	RejectInvalidPdataEnums bool
+
+	// IP2Location, if provided, is the path to an IP2Location database used to
+	// determine server regions. It should contain at least the country and
+	// region fields.
+	IP2Location string
+
+	// MainMenuPromos, if provided, is the path to a JSON file containing the
+	// main menu promos. It is reloaded when it changes or [Handler.ReloadPromos]
+	// is called. If it doesn't exist, empty promos are served.
+	MainMenuPromos string
+
+	// RateLimits overrides the rate limits for specific classes of requests.
+	// See [DefaultRateLimits] for the classes.
+	RateLimits map[string]RateLimits
+
+	// DisableRateLimit disables rate limiting.
+	DisableRateLimit bool
+
+	// AdminToken, if provided, is required as a bearer token to access
+	// administrative endpoints like /metrics.
+	AdminToken string
+
+	// SessionTTL is how long a session can go unused before it expires. If
+	// zero, it defaults to 24 hours. If negative, sessions never expire.
+	SessionTTL time.Duration
+
+	// PlayerAuthTTL is how long player authentication is valid for. If zero,
+	// it defaults to 12 hours. If negative, it never expires.
+	PlayerAuthTTL time.Duration
+
+	// ServerAuthTTL is how long server verification is valid for. If zero, it
+	// defaults to 1 hour. If negative, it never expires.
+	ServerAuthTTL time.Duration
+
+	// PdataLockTTL is how long a pdata write lock lasts without being renewed
+	// before it is removed, so locks held by crashed servers don't need to be
+	// taken over. If zero, it defaults to 12 hours. If negative, locks are
+	// only removed when released or taken over.
+	PdataLockTTL time.Duration
+
+	// ServerTTL is how long a server can go without a heartbeat before it is
+	// removed from the server list. If zero, it defaults to 45 seconds. If
+	// negative, servers are only removed explicitly.
+	ServerTTL time.Duration
+
+	// Logger, if provided, is used for logging. Otherwise, [log/slog.Default]
+	// is used.
+	Logger *slog.Logger
 }
 
 type Handler struct {
 	cfg Config
+
+	verifyMu sync.Mutex
+	verify   map[int64]serverVerify // [session id]
+
+	lockMu   sync.Mutex
+	lockUIDs map[uint64]*pdataMutex                // [uid]
+	lockWait map[uint64]map[chan struct{}]struct{} // [uid]
+
+	serverMu   sync.RWMutex
+	servers    map[string]*server        // [id]
+	serverAddr map[netip.AddrPort]string // [addr]id
+	serverSubs map[chan serverEvent]struct{}
+
+	serverListMu  sync.Mutex
+	serverList    atomic.Pointer[serverList]
+	serverListGen atomic.Uint64 // incremented when the server list changes
+
+	connectMu   sync.Mutex
+	connect     map[string]*pendingConnect  // [token]
+	connectDone map[string]connectTombstone // [token]
+
+	passwordMu sync.Mutex
+	password   map[serverPasswordKey]*serverPassword
+
+	ip2location     *ip2x.DB
+	ip2locationFile *os.File
+	regionMu        sync.Mutex
+	regionCache     map[netip.Addr]string
+
+	promosMu sync.Mutex // for reloading
+	promos   atomic.Pointer[promos]
+
+	rateLimit map[string]*rateLimiter // [class]
+
+	shutdown atomic.Bool
+
+	http httpMetrics
+
+	metrics struct {
+		region_lookup_count struct {
+			cached      atomic.Uint64
+			success     atomic.Uint64
+			best_effort atomic.Uint64
+			error       atomic.Uint64
+		}
+	}
 }
 
 func New(cfg Config) (*Handler, error) {
-	h := &Handler{cfg: cfg}
+	h := &Handler{
+		cfg:         cfg,
+		verify:      make(map[int64]serverVerify),
+		lockUIDs:    make(map[uint64]*pdataMutex),
+		lockWait:    make(map[uint64]map[chan struct{}]struct{}),
+		servers:     make(map[string]*server),
+		serverAddr:  make(map[netip.AddrPort]string),
+		serverSubs:  make(map[chan serverEvent]struct{}),
+		connect:     make(map[string]*pendingConnect),
+		connectDone: make(map[string]connectTombstone),
+		password:    make(map[serverPasswordKey]*serverPassword),
+		regionCache: make(map[netip.Addr]string),
+	}
 
 	if h.cfg.Mux == nil {
 		h.cfg.Mux = http.NewServeMux()
@@ -35,8 +167,37 @@ func New(cfg Config) (*Handler, error) {
 	if h.cfg.SessionStorage == nil {
 		return nil, fmt.Errorf("session storage is required")
 	}
+	if h.cfg.PlayerAuth == nil {
+		return nil, fmt.Errorf("player authenticator is required")
+	}
+	if h.cfg.SessionTTL == 0 {
+		h.cfg.SessionTTL = time.Hour * 24
+	}
+	if h.cfg.PlayerAuthTTL == 0 {
+		h.cfg.PlayerAuthTTL = time.Hour * 12
+	}
+	if h.cfg.ServerAuthTTL == 0 {
+		h.cfg.ServerAuthTTL = time.Hour
+	}
+	if h.cfg.PdataLockTTL == 0 {
+		h.cfg.PdataLockTTL = time.Hour * 12
+	}
+	if h.cfg.ServerTTL == 0 {
+		h.cfg.ServerTTL = time.Second * 45
+	}
+	if h.cfg.Logger == nil {
+		h.cfg.Logger = slog.Default()
+	}
+	if h.cfg.IP2Location != "" {
+		db, f, err := openIP2Location(h.cfg.IP2Location)
+		if err != nil {
+			return nil, fmt.Errorf("open ip2location database: %w", err)
+		}
+		h.ip2location, h.ip2locationFile = db, f
+	}
 
 	if err := h.init(); err != nil {
+		h.Close()
 		return nil, fmt.Errorf("init: %w", err)
 	}
 
@@ -44,6 +205,9 @@ func New(cfg Config) (*Handler, error) {
 }
 
 func (h *Handler) init() error {
+	if err := h.initRateLimit(); err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
 	if err := h.initAuth(); err != nil {
 		return fmt.Errorf("auth: %w", err)
 	}
@@ -59,6 +223,132 @@ func (h *Handler) init() error {
 	return nil
 }
 
+// Run runs background tasks until ctx is cancelled. It must only be called
+// once.
+func (h *Handler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, fn := range []func(context.Context){
+		h.runSweeper,
+		h.runServerExpiry,
+		h.runPromosWatcher,
+		h.runRateLimitSweeper,
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Shutdown wakes requests waiting for a pdata lock or streaming the server
+// list so they finish promptly, and makes new ones fail. It should be called
+// before draining requests. Pdata locks are kept in the session storage, so
+// clients can continue using them after a restart.
+func (h *Handler) Shutdown() {
+	h.shutdown.Store(true)
+	h.wakeAllLockWaiters()
+
+	h.serverMu.Lock()
+	for c := range h.serverSubs {
+		delete(h.serverSubs, c)
+		close(c)
+	}
+	h.serverMu.Unlock()
+}
+
+// errShuttingDown is returned for requests which can't complete since the
+// handler is shutting down.
+var errShuttingDown = Error{Code: ErrorCodeBackendServiceUnavailable, Message: "master server is shutting down"}
+
+// WritePrometheus writes prometheus text metrics to w.
+func (h *Handler) WritePrometheus(w io.Writer) {
+	h.writePrometheus(context.Background(), w)
+}
+
+func (h *Handler) writePrometheus(ctx context.Context, w io.Writer) {
+	h.http.writePrometheus(w)
+	h.writeServerMetrics(w)
+	h.writeSessionMetrics(ctx, w)
+	h.writeRegionMetrics(w)
+	h.writeRateLimitMetrics(w)
+	h.cfg.PdataStorage.WritePrometheus(w)
+	writeDBStats(w,
+		namedDBStats{"pdatadb", h.cfg.PdataStorage.DBStats()},
+		namedDBStats{"sessiondb", h.cfg.SessionStorage.DBStats()},
+	)
+	if h.cfg.Listener != nil {
+		h.cfg.Listener.WritePrometheus(w)
+	}
+}
+
+// Close releases the resources held by the handler. It must only be called
+// after requests have been drained and Run has returned.
+func (h *Handler) Close() error {
+	if h.ip2locationFile != nil {
+		if err := h.ip2locationFile.Close(); err != nil {
+			return fmt.Errorf("close ip2location database: %w", err)
+		}
+	}
+	return nil
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.cfg.Mux.ServeHTTP(w, r)
+	start := time.Now()
+	_, pattern := h.cfg.Mux.Handler(r)
+
+	mw := &metricsResponseWriter{ResponseWriter: w}
+	defer func() {
+		h.http.record(pattern, mw.status, mw.code, time.Since(start))
+	}()
+
+	if class, d, limited := h.checkRateLimit(r, pattern); limited {
+		mw.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+		Error{Code: ErrorCodeRateLimited, Message: "too many " + class + " requests"}.ServeHTTP(mw, r)
+		return
+	}
+	h.cfg.Mux.ServeHTTP(mw, r)
+}
+
+// newToken generates a new random opaque token.
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// remoteAddr gets the client IP address for the request.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	a, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Addr().Unmap().WithZone(""), true
+}
+
+// respondError writes err as an error response. If err is not an [Error], it
+// is treated as an internal error.
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	var e Error
+	if !errors.As(err, &e) {
+		e = Error{Code: ErrorCodeInternalError, Cause: err}
+	}
+	e.ServeHTTP(w, r)
+}
+
+// respondJSON writes obj as a JSON response.
+func respondJSON(w http.ResponseWriter, r *http.Request, status int, obj any) {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("encode response: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.Header().Set("Cache-Control", "private, no-cache, no-store")
+	w.WriteHeader(status)
+	w.Write(buf)
 }
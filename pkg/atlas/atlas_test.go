@@ -0,0 +1,379 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/db/pdatadb"
+	"github.com/r2northstar/atlas/v2/db/sessiondb"
+	"github.com/r2northstar/atlas/v2/pkg/nspkt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestHandler creates a handler with fresh databases, fake player
+// authentication, and logging and rate limiting disabled (unless cfg specifies
+// otherwise), serving it over http.
+func newTestHandler(t *testing.T, cfg Config) (*Handler, *httptest.Server) {
+	t.Helper()
+	ctx := context.Background()
+
+	pdb, err := pdatadb.Open(filepath.Join(t.TempDir(), "pdata.db"), pdatadb.Options{})
+	if err != nil {
+		t.Fatalf("open pdatadb: %v", err)
+	}
+	t.Cleanup(func() { pdb.Close() })
+	if _, to, err := pdb.Version(); err != nil {
+		t.Fatalf("get pdatadb version: %v", err)
+	} else if err := pdb.MigrateUp(ctx, to); err != nil {
+		t.Fatalf("migrate pdatadb: %v", err)
+	}
+
+	sdb, err := sessiondb.Open(filepath.Join(t.TempDir(), "session.db"), sessiondb.Options{})
+	if err != nil {
+		t.Fatalf("open sessiondb: %v", err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+	if _, to, err := sdb.Version(); err != nil {
+		t.Fatalf("get sessiondb version: %v", err)
+	} else if err := sdb.MigrateUp(ctx, to); err != nil {
+		t.Fatalf("migrate sessiondb: %v", err)
+	}
+
+	cfg.PdataStorage = pdb
+	cfg.SessionStorage = sdb
+	if cfg.PlayerAuth == nil {
+		cfg.PlayerAuth = &FakePlayerAuthenticator{}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if cfg.RateLimits == nil {
+		cfg.DisableRateLimit = true
+	}
+
+	h, err := New(cfg)
+	if err != nil {
+		t.Fatalf("create handler: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	return h, srv
+}
+
+// testClient makes requests to a test server using a session.
+type testClient struct {
+	srv   *httptest.Server
+	token string
+	key   string
+}
+
+// newTestSession creates a new session.
+func newTestSession(t *testing.T, srv *httptest.Server) *testClient {
+	t.Helper()
+	c := &testClient{srv: srv}
+	status, obj := c.do(t, context.Background(), "POST", "/auth", nil)
+	if status != http.StatusOK {
+		t.Fatalf("create session: status %d: %v", status, obj)
+	}
+	c.token = obj["token"].(string)
+	c.key = obj["key"].(string)
+	return c
+}
+
+// newTestPlayer creates a new session authenticated as uid.
+func newTestPlayer(t *testing.T, srv *httptest.Server, uid uint64) *testClient {
+	t.Helper()
+	c := newTestSession(t, srv)
+	status, obj := c.do(t, context.Background(), "POST", "/auth/player?uid="+strconv.FormatUint(uid, 10), url.Values{
+		"method": {"fake"},
+		"token":  {"player" + strconv.FormatUint(uid, 10)},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("authenticate player: status %d: %v", status, obj)
+	}
+	return c
+}
+
+// do makes a request, optionally with a form (url.Values), raw ([]byte), or
+// json body, returning the status code and decoded json response, if any. It
+// may be called from other goroutines, so it doesn't stop the test on failure.
+func (c *testClient) do(t *testing.T, ctx context.Context, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var (
+		r  io.Reader
+		ct string
+	)
+	switch body := body.(type) {
+	case nil:
+	case url.Values:
+		r, ct = strings.NewReader(body.Encode()), "application/x-www-form-urlencoded"
+	case []byte:
+		r, ct = bytes.NewReader(body), "application/octet-stream"
+	default:
+		buf, err := json.Marshal(body)
+		if err != nil {
+			t.Errorf("encode request: %v", err)
+			return 0, nil
+		}
+		r, ct = bytes.NewReader(buf), "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.srv.URL+path, r)
+	if err != nil {
+		t.Errorf("create request: %v", err)
+		return 0, nil
+	}
+	if ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.Errorf("%s %s: %v", method, path, err)
+		}
+		return 0, nil
+	}
+	defer resp.Body.Close()
+
+	var obj map[string]any
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		t.Errorf("%s %s: decode response: %v", method, path, err)
+	}
+	return resp.StatusCode, obj
+}
+
+// errorCode gets the error code from a response, if any.
+func errorCode(obj map[string]any) string {
+	if e, ok := obj["error"].(map[string]any); ok {
+		code, _ := e["code"].(string)
+		return code
+	}
+	return ""
+}
+
+// waitFor polls fn until it returns true, failing the test if it takes too
+// long.
+func waitFor(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !fn(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newTestListener starts a packet listener on localhost.
+func newTestListener(t *testing.T) *nspkt.Listener {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	l := nspkt.NewListener()
+	go l.Serve(conn)
+	t.Cleanup(l.Close)
+	return l
+}
+
+// testGameServer is a fake game server which replies to connect packets and
+// receives signed atlas requests.
+type testGameServer struct {
+	conn *net.UDPConn
+	gcm  cipher.AEAD
+	reqs chan map[string]any
+
+	mu        sync.Mutex
+	key       []byte
+	noConnect bool // don't reply to connect packets
+}
+
+// r2crypto parameters for the fake game server.
+const (
+	testR2cryptoNonceSize = 12
+	testR2cryptoTagSize   = 16
+)
+
+var (
+	testR2cryptoKey = []byte("X3V.bXCfe3EhN'wb")
+	testR2cryptoAAD = []byte("\x01\x02\x03\x04\x05\x06\x07\x08\t\n\x0b\x0c\r\x0e\x0f\x10")
+)
+
+// newTestGameServer starts a fake game server on localhost which verifies
+// atlas requests using key.
+func newTestGameServer(t *testing.T, key string) *testGameServer {
+	t.Helper()
+
+	c, err := aes.NewCipher(testR2cryptoKey)
+	if err != nil {
+		t.Fatalf("init aes: %v", err)
+	}
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		t.Fatalf("init gcm: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	g := &testGameServer{
+		conn: conn,
+		gcm:  gcm,
+		key:  []byte(key),
+		reqs: make(chan map[string]any, 16),
+	}
+	go g.serve(t)
+	return g
+}
+
+// Port returns the port the game server is listening on.
+func (g *testGameServer) Port() int {
+	return g.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// SetKey changes the key used to verify atlas requests.
+func (g *testGameServer) SetKey(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.key = []byte(key)
+}
+
+// SetUnreachable makes the game server ignore connect packets.
+func (g *testGameServer) SetUnreachable(unreachable bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.noConnect = unreachable
+}
+
+// Request waits for the next signed atlas request.
+func (g *testGameServer) Request(t *testing.T) map[string]any {
+	t.Helper()
+	select {
+	case obj := <-g.reqs:
+		return obj
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for atlas request")
+		panic("unreachable")
+	}
+}
+
+func (g *testGameServer) serve(t *testing.T) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := g.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return // closed
+		}
+		if n < testR2cryptoNonceSize+testR2cryptoTagSize {
+			continue
+		}
+		var (
+			nonce = buf[:testR2cryptoNonceSize]
+			tag   = buf[testR2cryptoNonceSize:][:testR2cryptoTagSize]
+			ct    = buf[testR2cryptoNonceSize+testR2cryptoTagSize : n]
+		)
+		data, err := g.gcm.Open(nil, nonce, append(bytes.Clone(ct), tag...), testR2cryptoAAD)
+		if err != nil {
+			t.Errorf("game server: decrypt packet: %v", err)
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(data, []byte("\xFF\xFF\xFF\xFFHconnect\x00")) && len(data) >= 13+8:
+			g.mu.Lock()
+			ignore := g.noConnect
+			g.mu.Unlock()
+			if ignore {
+				continue
+			}
+
+			var b []byte
+			b = append(b, "\xFF\xFF\xFF\xFF"...)
+			b = append(b, 'I')
+			b = binary.LittleEndian.AppendUint32(b, 1234) // challenge
+			b = append(b, data[13:][:8]...)               // uid
+			b = append(b, "connect\x00"...)
+			b = binary.LittleEndian.AppendUint32(b, 0)
+
+			// Seal returns ct|tag, but r2crypto packets are nonce|tag|ct
+			pkt := make([]byte, testR2cryptoNonceSize, testR2cryptoNonceSize+testR2cryptoTagSize+len(b))
+			rand.Read(pkt)
+			sealed := g.gcm.Seal(nil, pkt, b, testR2cryptoAAD)
+			pkt = append(pkt, sealed[len(b):]...)
+			pkt = append(pkt, sealed[:len(b)]...)
+			g.conn.WriteToUDPAddrPort(pkt, addr)
+
+		case bytes.HasPrefix(data, []byte("\xFF\xFF\xFF\xFFTsigreq1\x00")) && len(data) >= 13+sha256.Size:
+			sig, msg := data[13:][:sha256.Size], data[13+sha256.Size:]
+
+			g.mu.Lock()
+			m := hmac.New(sha256.New, g.key)
+			g.mu.Unlock()
+			m.Write(msg)
+			if !hmac.Equal(m.Sum(nil), sig) {
+				t.Errorf("game server: invalid atlas request signature")
+				continue
+			}
+
+			var obj map[string]any
+			if err := json.Unmarshal(msg, &obj); err != nil {
+				t.Errorf("game server: decode atlas request: %v", err)
+				continue
+			}
+			g.reqs <- obj
+		}
+	}
+}
+
+// newTestServer creates a session for a fake game server and verifies it.
+func newTestServer(t *testing.T, srv *httptest.Server) (*testClient, *testGameServer) {
+	t.Helper()
+	c := newTestSession(t, srv)
+	g := newTestGameServer(t, c.key)
+	port := strconv.Itoa(g.Port())
+
+	if status, obj := c.do(t, context.Background(), "POST", "/auth/server?port="+port, nil); status != http.StatusAccepted {
+		t.Fatalf("request server verification: status %d: %v", status, obj)
+	}
+	req := g.Request(t)
+	if req["type"] != "verify" {
+		t.Fatalf("expected verify request, got %v", req)
+	}
+	if status, obj := c.do(t, context.Background(), "POST", "/auth/server?port="+port+"&token="+req["token"].(string), nil); status != http.StatusOK {
+		t.Fatalf("verify server: status %d: %v", status, obj)
+	}
+	return c, g
+}
@@ -1,5 +1,426 @@
 package atlas
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/db/sessiondb"
+)
+
 func (h *Handler) initAuth() error {
+	h.cfg.Mux.HandleFunc("POST /auth", h.handleAuth)
+	h.cfg.Mux.HandleFunc("POST /auth/player", h.handleAuthPlayer)
+	h.cfg.Mux.HandleFunc("POST /auth/server", h.handleAuthServer)
+	return nil
+}
+
+// handleAuth creates a new session.
+func (h *Handler) handleAuth(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength != 0 {
+		Error{Code: ErrorCodeBadRequest, Message: "request body must be empty"}.ServeHTTP(w, r)
+		return
+	}
+	if len(r.URL.Query()) != 0 {
+		Error{Code: ErrorCodeBadRequest, Message: "unexpected query parameters"}.ServeHTTP(w, r)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("generate session token: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	key, err := newToken()
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("generate session key: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"remote_addr": r.RemoteAddr,
+		"user_agent":  r.UserAgent(),
+	})
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("encode session data: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	if _, err := h.cfg.SessionStorage.CreateSession(r.Context(), token, key, data); err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("create session: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"token": token,
+		"key":   key,
+	})
+}
+
+// handleAuthPlayer verifies the player for the current session.
+func (h *Handler) handleAuthPlayer(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(r.URL.Query().Get("uid"), 10, 64)
+	if err != nil || uid == 0 {
+		Error{Code: ErrorCodeBadRequest, Message: "invalid or missing uid"}.ServeHTTP(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error{Code: ErrorCodeBadRequest, Message: "invalid form body", Cause: err}.ServeHTTP(w, r)
+		return
+	}
+	method, token := r.PostForm.Get("method"), r.PostForm.Get("token")
+	if method == "" {
+		Error{Code: ErrorCodeBadRequest, Message: "missing auth method"}.ServeHTTP(w, r)
+		return
+	}
+
+	sess, err := h.requireSession(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	vuid, username, err := h.cfg.PlayerAuth.AuthenticatePlayer(r.Context(), method, token, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPlayerAuthUnsupported):
+			Error{Code: ErrorCodeBadRequest, Message: err.Error()}.ServeHTTP(w, r)
+		case errors.Is(err, ErrPlayerAuthFailed):
+			Error{Code: ErrorCodeAuthPlayerFailed, Message: strings.TrimPrefix(err.Error(), ErrPlayerAuthFailed.Error()+": ")}.ServeHTTP(w, r)
+		case errors.Is(err, ErrPlayerAuthUnavailable):
+			Error{Code: ErrorCodeBackendServiceUnavailable, Cause: err}.ServeHTTP(w, r)
+		default:
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("authenticate player: %w", err)}.ServeHTTP(w, r)
+		}
+		return
+	}
+	if vuid != uid {
+		Error{Code: ErrorCodeAuthPlayerFailed, Message: "token is for a different player"}.ServeHTTP(w, r)
+		return
+	}
+
+	ip, _ := remoteAddr(r)
+	if err := h.checkBan(r.Context(), uid, ip, netip.AddrPort{}); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if err := h.cfg.SessionStorage.SetPlayerSession(r.Context(), sess.ID, uid, username); err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("set player session: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	if username == "" {
+		if u, _, err := h.cfg.SessionStorage.GetPlayerUsername(r.Context(), uid); err != nil {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get player username: %w", err)}.ServeHTTP(w, r)
+			return
+		} else {
+			username = u
+		}
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"uid":      uid,
+		"username": username,
+	})
+}
+
+// sessionToken gets the session token from the request, returning an empty
+// string if none was provided.
+func sessionToken(r *http.Request) string {
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// requireSession gets the session for the request.
+func (h *Handler) requireSession(r *http.Request) (sessiondb.Session, error) {
+	token := sessionToken(r)
+	if token == "" {
+		return sessiondb.Session{}, Error{Code: ErrorCodeAuthMissing}
+	}
+	sess, exists, err := h.cfg.SessionStorage.GetSession(r.Context(), token)
+	if err != nil {
+		return sessiondb.Session{}, Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get session: %w", err)}
+	}
+	if !exists {
+		return sessiondb.Session{}, Error{Code: ErrorCodeAuthInvalid}
+	}
+	if h.cfg.SessionTTL > 0 && time.Since(sess.Used) > h.cfg.SessionTTL {
+		return sessiondb.Session{}, Error{Code: ErrorCodeAuthInvalid, Message: "session expired"}
+	}
+	if time.Since(sess.Used) > sessionTouchInterval {
+		if err := h.cfg.SessionStorage.TouchSession(r.Context(), sess.ID); err != nil {
+			return sessiondb.Session{}, Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("touch session: %w", err)}
+		}
+	}
+	return sess, nil
+}
+
+// requirePlayer gets the session for the request, ensuring it is the current
+// session for a verified player.
+func (h *Handler) requirePlayer(r *http.Request) (sessiondb.Session, error) {
+	sess, err := h.requireSession(r)
+	if err != nil {
+		return sess, err
+	}
+	return sess, h.checkPlayer(r.Context(), sess)
+}
+
+// checkPlayer ensures sess is the current session for a verified player.
+func (h *Handler) checkPlayer(ctx context.Context, sess sessiondb.Session) error {
+	if sess.PlayerUID == 0 {
+		return Error{Code: ErrorCodeAuthPlayerMissing}
+	}
+	ps, exists, err := h.cfg.SessionStorage.GetPlayerSession(ctx, sess.PlayerUID)
+	if err != nil {
+		return Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get player session: %w", err)}
+	}
+	if !exists {
+		return Error{Code: ErrorCodeAuthPlayerExpired} // swept
+	}
+	if ps.SessionID != sess.ID {
+		return Error{Code: ErrorCodeAuthPlayerDestroyed}
+	}
+	if h.cfg.PlayerAuthTTL > 0 && time.Since(ps.Created) > h.cfg.PlayerAuthTTL {
+		return Error{Code: ErrorCodeAuthPlayerExpired}
+	}
+	return nil
+}
+
+// sessionTouchInterval is how often the last used time of a session is
+// updated.
+const sessionTouchInterval = time.Minute
+
+// sweepInterval is how often expired sessions are removed.
+const sweepInterval = time.Minute
+
+// runSweeper periodically removes expired sessions until ctx is cancelled.
+func (h *Handler) runSweeper(ctx context.Context) {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+
+	for {
+		h.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sweep removes expired sessions and pdata locks.
+func (h *Handler) sweep(ctx context.Context) {
+	var (
+		now           = time.Now()
+		sessionBefore time.Time
+		playerBefore  time.Time
+		serverBefore  time.Time
+	)
+	if h.cfg.SessionTTL > 0 {
+		sessionBefore = now.Add(-h.cfg.SessionTTL)
+	}
+	if h.cfg.PlayerAuthTTL > 0 {
+		playerBefore = now.Add(-h.cfg.PlayerAuthTTL)
+	}
+	if h.cfg.ServerAuthTTL > 0 {
+		serverBefore = now.Add(-h.cfg.ServerAuthTTL)
+	}
+
+	res, err := h.cfg.SessionStorage.Sweep(ctx, sessionBefore, playerBefore, serverBefore)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.cfg.Logger.Error("failed to sweep expired sessions", "error", err)
+		}
+		return
+	}
+
+	lvl := slog.LevelDebug
+	if res != (sessiondb.SweepResult{}) {
+		lvl = slog.LevelInfo
+	}
+	h.cfg.Logger.Log(ctx, lvl, "swept expired sessions",
+		"sessions", res.Sessions,
+		"player_sessions", res.PlayerSessions,
+		"server_sessions", res.ServerSessions,
+	)
+
+	if h.cfg.PdataLockTTL > 0 {
+		n, err := h.cfg.SessionStorage.SweepPdataLocks(ctx, now.Add(-h.cfg.PdataLockTTL))
+		if err != nil {
+			if ctx.Err() == nil {
+				h.cfg.Logger.Error("failed to sweep expired pdata locks", "error", err)
+			}
+			return
+		}
+		if n != 0 {
+			h.wakeAllLockWaiters() // so they see the lock is gone
+			h.cfg.Logger.Info("swept expired pdata locks", "pdata_locks", n)
+		}
+	}
+}
+
+// serverVerifyTimeout is how long a server has to complete verification after
+// the verification packet is sent.
+const serverVerifyTimeout = 10 * time.Second
+
+// serverVerify is a pending server verification.
+type serverVerify struct {
+	Addr    netip.AddrPort
+	Token   string
+	Expires time.Time
+}
+
+// handleAuthServer verifies the server for the current session.
+func (h *Handler) handleAuthServer(w http.ResponseWriter, r *http.Request) {
+	var ip netip.Addr
+	switch x := r.URL.Query().Get("ip"); x {
+	case "", "self":
+		if a, ok := remoteAddr(r); !ok {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("invalid remote address %q", r.RemoteAddr)}.ServeHTTP(w, r)
+			return
+		} else {
+			ip = a
+		}
+	default:
+		if a, err := netip.ParseAddr(x); err != nil {
+			Error{Code: ErrorCodeBadRequest, Message: "invalid ip"}.ServeHTTP(w, r)
+			return
+		} else {
+			ip = a.Unmap().WithZone("")
+		}
+	}
+
+	port, err := strconv.ParseUint(r.URL.Query().Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		Error{Code: ErrorCodeBadRequest, Message: "invalid or missing port"}.ServeHTTP(w, r)
+		return
+	}
+	addr := netip.AddrPortFrom(ip, uint16(port))
+
+	sess, err := h.requireSession(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if err := h.checkBan(r.Context(), 0, ip, addr); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if a, ok := remoteAddr(r); ok && a != ip {
+		if err := h.checkBan(r.Context(), 0, a, netip.AddrPort{}); err != nil {
+			respondError(w, r, err)
+			return
+		}
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		now := time.Now()
+
+		h.verifyMu.Lock()
+		v, ok := h.verify[sess.ID]
+		if ok && v.Addr == addr && v.Token == token {
+			delete(h.verify, sess.ID)
+		}
+		h.verifyMu.Unlock()
+
+		if !ok || v.Addr != addr || v.Token != token || now.After(v.Expires) {
+			Error{Code: ErrorCodeAuthServerFailed, Message: "invalid or expired verification token"}.ServeHTTP(w, r)
+			return
+		}
+
+		if err := h.cfg.SessionStorage.SetServerSession(r.Context(), sess.ID, addr); err != nil {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("set server session: %w", err)}.ServeHTTP(w, r)
+			return
+		}
+
+		respondJSON(w, r, http.StatusOK, map[string]any{
+			"addr":     addr.String(),
+			"verified": true,
+		})
+		return
+	}
+
+	if h.cfg.Listener == nil {
+		Error{Code: ErrorCodeBackendServiceUnavailable, Message: "server verification is not available"}.ServeHTTP(w, r)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("generate verification token: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	now := time.Now()
+
+	h.verifyMu.Lock()
+	for id, v := range h.verify {
+		if now.After(v.Expires) {
+			delete(h.verify, id)
+		}
+	}
+	h.verify[sess.ID] = serverVerify{
+		Addr:    addr,
+		Token:   token,
+		Expires: now.Add(serverVerifyTimeout),
+	}
+	h.verifyMu.Unlock()
+
+	if err := h.cfg.Listener.SendAtlasSigreq1(addr, sess.Key, map[string]any{
+		"type":  "verify",
+		"token": token,
+	}); err != nil {
+		Error{Code: ErrorCodeBackendServiceUnavailable, Cause: fmt.Errorf("send verification packet: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	respondJSON(w, r, http.StatusAccepted, map[string]any{
+		"addr":     addr.String(),
+		"verified": false,
+	})
+}
+
+// requireServer gets the session for the request, ensuring it is the current
+// session for a verified server.
+func (h *Handler) requireServer(r *http.Request) (sessiondb.Session, error) {
+	sess, err := h.requireSession(r)
+	if err != nil {
+		return sess, err
+	}
+	return sess, h.checkServer(r.Context(), sess)
+}
+
+// checkServer ensures sess is the current session for a verified server.
+func (h *Handler) checkServer(ctx context.Context, sess sessiondb.Session) error {
+	if !sess.ServerAddr.IsValid() {
+		return Error{Code: ErrorCodeAuthServerMissing}
+	}
+	ss, exists, err := h.cfg.SessionStorage.GetServerSession(ctx, sess.ServerAddr)
+	if err != nil {
+		return Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get server session: %w", err)}
+	}
+	if !exists {
+		return Error{Code: ErrorCodeAuthServerExpired} // swept
+	}
+	if ss.SessionID != sess.ID {
+		return Error{Code: ErrorCodeAuthServerDestroyed}
+	}
+	if h.cfg.ServerAuthTTL > 0 && time.Since(ss.Created) > h.cfg.ServerAuthTTL {
+		return Error{Code: ErrorCodeAuthServerExpired}
+	}
 	return nil
 }
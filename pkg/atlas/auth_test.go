@@ -0,0 +1,307 @@
+package atlas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	_, srv := newTestHandler(t, Config{})
+
+	t.Run("Create", func(t *testing.T) {
+		a, b := newTestSession(t, srv), newTestSession(t, srv)
+		if a.token == "" || a.key == "" {
+			t.Fatalf("expected a token and key, got %q and %q", a.token, a.key)
+		}
+		if a.token == b.token || a.key == b.key {
+			t.Errorf("expected sessions to have unique tokens and keys")
+		}
+		if a.token == a.key {
+			t.Errorf("expected the token and key to differ")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		c := &testClient{srv: srv}
+		for _, tc := range []struct {
+			Name string
+			Path string
+			Body any
+		}{
+			{"Query", "/auth?uid=1", nil},
+			{"Body", "/auth", url.Values{"uid": {"1"}}},
+		} {
+			if _, obj := c.do(t, context.Background(), "POST", tc.Path, tc.Body); errorCode(obj) != ErrorCodeBadRequest {
+				t.Errorf("%s: expected %s, got %v", tc.Name, ErrorCodeBadRequest, obj)
+			}
+		}
+	})
+}
+
+func TestAuthPlayer(t *testing.T) {
+	t.Run("Fake", func(t *testing.T) {
+		_, srv := newTestHandler(t, Config{
+			PlayerAuth: &FakePlayerAuthenticator{Methods: []string{"fake"}},
+		})
+		c := newTestSession(t, srv)
+
+		for _, tc := range []struct {
+			Name   string
+			Query  string
+			Method string
+			Token  string
+			Code   string
+		}{
+			{"OK", "uid=1", "fake", "test", ""},
+			{"EmptyToken", "uid=1", "fake", "", ErrorCodeAuthPlayerFailed},
+			{"UnsupportedMethod", "uid=1", "origin", "test", ErrorCodeBadRequest},
+			{"MissingMethod", "uid=1", "", "test", ErrorCodeBadRequest},
+			{"MissingUID", "", "fake", "test", ErrorCodeBadRequest},
+		} {
+			status, obj := c.do(t, context.Background(), "POST", "/auth/player?"+tc.Query, url.Values{
+				"method": {tc.Method},
+				"token":  {tc.Token},
+			})
+			if code := errorCode(obj); code != tc.Code {
+				t.Errorf("%s: expected error %q, got %v", tc.Name, tc.Code, obj)
+			} else if code == "" && (status != http.StatusOK || obj["uid"] != 1.0 || obj["username"] != "test") {
+				t.Errorf("%s: unexpected response: status %d: %v", tc.Name, status, obj)
+			}
+		}
+	})
+
+	t.Run("Origin", func(t *testing.T) {
+		for _, tc := range []struct {
+			Name   string
+			Status int
+			Body   string
+			Code   string
+		}{
+			{"OK", 200, `{"success":true,"status":"200","hasOnlineAccess":"1"}`, ""},
+			{"InvalidToken", 200, `{"success":false,"status":"401","error":"bad token"}`, ErrorCodeAuthPlayerFailed},
+			{"Unavailable", 503, `unavailable`, ErrorCodeBackendServiceUnavailable},
+		} {
+			_, srv := newTestHandler(t, Config{
+				PlayerAuth: &OriginPlayerAuthenticator{Client: newStubStryder(t, tc.Status, tc.Body)},
+			})
+			c := newTestSession(t, srv)
+
+			status, obj := c.do(t, context.Background(), "POST", "/auth/player?uid=1", url.Values{
+				"method": {"origin"},
+				"token":  {"token"},
+			})
+			if code := errorCode(obj); code != tc.Code {
+				t.Errorf("%s: expected error %q, got %v", tc.Name, tc.Code, obj)
+			} else if code == "" && (status != http.StatusOK || obj["uid"] != 1.0 || obj["username"] != "") {
+				t.Errorf("%s: unexpected response: status %d: %v", tc.Name, status, obj)
+			}
+		}
+	})
+
+	t.Run("Takeover", func(t *testing.T) {
+		h, srv := newTestHandler(t, Config{})
+		a := newTestPlayer(t, srv, 1)
+		b := newTestPlayer(t, srv, 1)
+		other := newTestPlayer(t, srv, 2)
+
+		for _, tc := range []struct {
+			Name   string
+			Client *testClient
+			Code   string
+		}{
+			{"Old", a, ErrorCodeAuthPlayerDestroyed},
+			{"New", b, ""},
+			{"OtherPlayer", other, ""},
+			{"Unauthenticated", newTestSession(t, srv), ErrorCodeAuthPlayerMissing},
+		} {
+			code := requestCode(t, tc.Client, func(r *http.Request) error {
+				_, err := h.requirePlayer(r)
+				return err
+			})
+			if code != tc.Code {
+				t.Errorf("%s: expected error %q, got %q", tc.Name, tc.Code, code)
+			}
+		}
+	})
+}
+
+// requestCode gets the error code returned by fn for a request using the
+// session for c.
+func requestCode(t *testing.T, c *testClient, fn func(*http.Request) error) string {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	if err := fn(r); err != nil {
+		var e Error
+		if !errors.As(err, &e) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(e.Code)
+	}
+	return ""
+}
+
+func TestAuthServer(t *testing.T) {
+	h, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+	requireServer := func(r *http.Request) error {
+		_, err := h.requireServer(r)
+		return err
+	}
+
+	t.Run("Verify", func(t *testing.T) {
+		c, g := newTestServer(t, srv)
+		if code := requestCode(t, c, requireServer); code != "" {
+			t.Errorf("expected verified server, got error %q", code)
+		}
+
+		// a new session for the same address replaces it
+		d := newTestSession(t, srv)
+		g.SetKey(d.key)
+		port := strconv.Itoa(g.Port())
+		d.do(t, context.Background(), "POST", "/auth/server?port="+port, nil)
+		if status, obj := d.do(t, context.Background(), "POST", "/auth/server?port="+port+"&token="+g.Request(t)["token"].(string), nil); status != http.StatusOK {
+			t.Fatalf("verify server: status %d: %v", status, obj)
+		}
+		if code := requestCode(t, c, requireServer); code != ErrorCodeAuthServerDestroyed {
+			t.Errorf("expected %s for the old session, got %q", ErrorCodeAuthServerDestroyed, code)
+		}
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		c := newTestSession(t, srv)
+		g := newTestGameServer(t, c.key)
+		port := strconv.Itoa(g.Port())
+
+		c.do(t, context.Background(), "POST", "/auth/server?port="+port, nil)
+		token := g.Request(t)["token"].(string)
+
+		for _, tc := range []struct {
+			Name  string
+			Query string
+		}{
+			{"WrongToken", "port=" + port + "&token=wrong"},
+			{"WrongPort", "port=1&token=" + token},
+		} {
+			if _, obj := c.do(t, context.Background(), "POST", "/auth/server?"+tc.Query, nil); errorCode(obj) != ErrorCodeAuthServerFailed {
+				t.Errorf("%s: expected %s, got %v", tc.Name, ErrorCodeAuthServerFailed, obj)
+			}
+		}
+
+		if status, obj := c.do(t, context.Background(), "POST", "/auth/server?port="+port+"&token="+token, nil); status != http.StatusOK {
+			t.Fatalf("verify server: status %d: %v", status, obj)
+		}
+		if _, obj := c.do(t, context.Background(), "POST", "/auth/server?port="+port+"&token="+token, nil); errorCode(obj) != ErrorCodeAuthServerFailed {
+			t.Errorf("expected %s for a reused token, got %v", ErrorCodeAuthServerFailed, obj)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		if code := requestCode(t, newTestSession(t, srv), requireServer); code != ErrorCodeAuthServerMissing {
+			t.Errorf("expected %s, got %q", ErrorCodeAuthServerMissing, code)
+		}
+	})
+
+	t.Run("InvalidPort", func(t *testing.T) {
+		c := newTestSession(t, srv)
+		if _, obj := c.do(t, context.Background(), "POST", "/auth/server?port=0", nil); errorCode(obj) != ErrorCodeBadRequest {
+			t.Errorf("expected %s, got %v", ErrorCodeBadRequest, obj)
+		}
+	})
+
+	t.Run("NoListener", func(t *testing.T) {
+		_, srv := newTestHandler(t, Config{})
+		c := newTestSession(t, srv)
+		if _, obj := c.do(t, context.Background(), "POST", "/auth/server?port=1", nil); errorCode(obj) != ErrorCodeBackendServiceUnavailable {
+			t.Errorf("expected %s, got %v", ErrorCodeBackendServiceUnavailable, obj)
+		}
+	})
+}
+
+func TestSessionExpiry(t *testing.T) {
+	// since times are stored with second precision, wait until the second
+	// after the rows were created before sweeping
+	nextSecond := func() {
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second + 10*time.Millisecond)))
+	}
+
+	t.Run("Session", func(t *testing.T) {
+		h, srv := newTestHandler(t, Config{SessionTTL: time.Millisecond})
+		c := newTestSession(t, srv)
+		time.Sleep(5 * time.Millisecond)
+
+		requireSession := func(r *http.Request) error {
+			_, err := h.requireSession(r)
+			return err
+		}
+		if code := requestCode(t, c, requireSession); code != ErrorCodeAuthInvalid {
+			t.Errorf("expected %s, got %q", ErrorCodeAuthInvalid, code)
+		}
+
+		nextSecond()
+		h.sweep(context.Background())
+		if _, exists, err := h.cfg.SessionStorage.GetSession(context.Background(), c.token); err != nil {
+			t.Fatalf("get session: %v", err)
+		} else if exists {
+			t.Errorf("expected expired session to be swept")
+		}
+	})
+
+	t.Run("PlayerAndServer", func(t *testing.T) {
+		h, srv := newTestHandler(t, Config{
+			Listener:      newTestListener(t),
+			PlayerAuthTTL: time.Millisecond,
+			ServerAuthTTL: time.Millisecond,
+		})
+		p := newTestPlayer(t, srv, 1)
+		s, g := newTestServer(t, srv)
+		time.Sleep(5 * time.Millisecond)
+
+		requirePlayer := func(r *http.Request) error {
+			_, err := h.requirePlayer(r)
+			return err
+		}
+		requireServer := func(r *http.Request) error {
+			_, err := h.requireServer(r)
+			return err
+		}
+		check := func(when string) {
+			t.Helper()
+			if code := requestCode(t, p, requirePlayer); code != ErrorCodeAuthPlayerExpired {
+				t.Errorf("%s: expected %s, got %q", when, ErrorCodeAuthPlayerExpired, code)
+			}
+			if code := requestCode(t, s, requireServer); code != ErrorCodeAuthServerExpired {
+				t.Errorf("%s: expected %s, got %q", when, ErrorCodeAuthServerExpired, code)
+			}
+		}
+		check("before sweep")
+
+		nextSecond()
+		h.sweep(context.Background())
+		if _, exists, err := h.cfg.SessionStorage.GetPlayerSession(context.Background(), 1); err != nil {
+			t.Fatalf("get player session: %v", err)
+		} else if exists {
+			t.Errorf("expected expired player session to be swept")
+		}
+		if _, exists, err := h.cfg.SessionStorage.GetServerSession(context.Background(), netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), uint16(g.Port()))); err != nil {
+			t.Fatalf("get server session: %v", err)
+		} else if exists {
+			t.Errorf("expected expired server session to be swept")
+		}
+		check("after sweep")
+
+		// the sessions themselves are still valid
+		if code := requestCode(t, p, func(r *http.Request) error {
+			_, err := h.requireSession(r)
+			return err
+		}); code != "" {
+			t.Errorf("expected session to still be valid, got %q", code)
+		}
+	})
+}
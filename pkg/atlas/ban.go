@@ -0,0 +1,44 @@
+package atlas
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+)
+
+// checkBan checks whether the player uid, ip, or server address is banned,
+// ignoring zero or invalid values.
+func (h *Handler) checkBan(ctx context.Context, uid uint64, ip netip.Addr, server netip.AddrPort) error {
+	ban, exists, err := h.cfg.SessionStorage.FindBan(ctx, uid, ip, server)
+	if err != nil {
+		return Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("find ban: %w", err)}
+	}
+	if !exists {
+		return nil
+	}
+	msg := ban.Reason
+	if !ban.Expires.IsZero() {
+		msg += " (until " + ban.Expires.UTC().Format(time.RFC3339) + ")"
+	}
+	return Error{Code: ErrorCodeBanned, Message: msg}
+}
+
+// isCheater checks whether the player's pdata has the isACheater flag set.
+func (h *Handler) isCheater(uid uint64) (bool, error) {
+	buf, exists, err := h.cfg.PdataStorage.GetPdataCached(uid, [sha256.Size]byte{})
+	if err != nil {
+		return false, fmt.Errorf("get pdata: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	var pd pdata.Pdata
+	if err := pd.UnmarshalBinary(buf); err != nil {
+		return false, fmt.Errorf("decode pdata: %w", err)
+	}
+	return pd.IsACheater, nil
+}
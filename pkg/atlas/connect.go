@@ -0,0 +1,375 @@
+package atlas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// connectProbeInterval is how often to resend the connect packet while
+// waiting for a response.
+const connectProbeInterval = 500 * time.Millisecond
+
+// These are variables so tests can shorten them.
+var (
+	// connectProbeTimeout is how long to wait for a game server to respond to
+	// the connectionless connect packet before giving up.
+	connectProbeTimeout = 3 * time.Second
+
+	// connectTimeout is how long a game server has to respond to a connect
+	// token.
+	connectTimeout = 10 * time.Second
+
+	// connectTombstoneTTL is how long finished connect tokens are remembered
+	// for so late or duplicate responses can be identified.
+	connectTombstoneTTL = time.Minute
+
+	// maxConnectDataLength is the maximum length of the data param for connect
+	// responses.
+	maxConnectDataLength = 256
+)
+
+// pendingConnect is a player connection waiting for a response from the game
+// server.
+type pendingConnect struct {
+	ServerID string
+	UID      uint64
+	Lock     string // pdata lock token if the connection is read/write
+	Expires  time.Time
+	Result   chan connectResult // buffered
+}
+
+// connectResult is the game server's response to a connection.
+type connectResult struct {
+	Result   string // ok, reject, password_required
+	Message  string // for reject
+	Nonce    string // for password_required
+	Readonly bool   // for ok
+	Err      error  // if the response couldn't be processed
+}
+
+// connectTombstone is a connect token which is no longer pending.
+type connectTombstone struct {
+	ServerID  string
+	Responded bool // if false, the player stopped waiting
+	Expires   time.Time
+}
+
+// finishConnectLocked removes a pending connect token, leaving a tombstone.
+// h.connectMu must be held.
+func (h *Handler) finishConnectLocked(token string, pc *pendingConnect, responded bool) {
+	now := time.Now()
+	for t, x := range h.connectDone {
+		if now.After(x.Expires) {
+			delete(h.connectDone, t)
+		}
+	}
+	delete(h.connect, token)
+	h.connectDone[token] = connectTombstone{
+		ServerID:  pc.ServerID,
+		Responded: responded,
+		Expires:   now.Add(connectTombstoneTTL),
+	}
+}
+
+// probeServer checks whether a game server is reachable by sending connect
+// packets until it replies.
+func (h *Handler) probeServer(ctx context.Context, addr netip.AddrPort, uid uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, connectProbeTimeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.cfg.Listener.WaitConnectReply(ctx, addr, uid)
+	}()
+
+	t := time.NewTicker(connectProbeInterval)
+	defer t.Stop()
+
+	for {
+		if err := h.cfg.Listener.SendConnect(addr, uid); err != nil {
+			return err
+		}
+		select {
+		case err := <-errc:
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// handleConnectServer connects the current player to a server.
+func (h *Handler) handleConnectServer(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.requirePlayer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	ip, _ := remoteAddr(r)
+	if err := h.checkBan(r.Context(), sess.PlayerUID, ip, netip.AddrPort{}); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	s, ok := h.getServer(r.PathValue("id"))
+	if !ok {
+		Error{Code: ErrorCodeServerNotFound}.ServeHTTP(w, r)
+		return
+	}
+
+	lock := r.URL.Query().Get("lock")
+	if lock != "" {
+		if ok, err := h.checkPdataLock(r.Context(), sess.PlayerUID, lock); err != nil {
+			respondError(w, r, err)
+			return
+		} else if !ok {
+			Error{Code: ErrorCodePdataLocked}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	pkey := serverPasswordKey{
+		UID:      sess.PlayerUID,
+		ServerID: s.ID,
+	}
+	password := r.URL.Query().Get("password")
+	if password != "" {
+		if err := parseServerPassword(password); err != nil {
+			respondError(w, r, err)
+			return
+		}
+	}
+	if d, limited := h.checkServerPasswordLimit(pkey); limited {
+		w.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+		Error{Code: ErrorCodeServerPasswordRateLimited}.ServeHTTP(w, r)
+		return
+	}
+
+	if h.cfg.Listener == nil {
+		Error{Code: ErrorCodeBackendServiceUnavailable, Message: "server connections are not available"}.ServeHTTP(w, r)
+		return
+	}
+
+	username, _, err := h.cfg.SessionStorage.GetPlayerUsername(r.Context(), sess.PlayerUID)
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get player username: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	cheater, err := h.isCheater(sess.PlayerUID)
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: err}.ServeHTTP(w, r)
+		return
+	}
+
+	if err := h.probeServer(r.Context(), s.Addr, sess.PlayerUID); err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			Error{Code: ErrorCodeServerUnreachable, Message: "server did not respond to connect packet"}.ServeHTTP(w, r)
+		} else {
+			Error{Code: ErrorCodeBackendServiceUnavailable, Cause: fmt.Errorf("send connect packet: %w", err)}.ServeHTTP(w, r)
+		}
+		return
+	}
+
+	var nonce string
+	if password != "" {
+		var ok bool
+		if nonce, ok = h.takeServerPasswordNonce(pkey); !ok {
+			Error{Code: ErrorCodeBadRequest, Message: "no pending password challenge (connect without a password first)", Field: "password"}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("generate connect token: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	pc := &pendingConnect{
+		ServerID: s.ID,
+		UID:      sess.PlayerUID,
+		Lock:     lock,
+		Expires:  time.Now().Add(connectTimeout),
+		Result:   make(chan connectResult, 1),
+	}
+
+	h.connectMu.Lock()
+	h.connect[token] = pc
+	h.connectMu.Unlock()
+
+	// stop waiting for the token, returning true if the server already
+	// responded
+	cancelConnect := func() bool {
+		h.connectMu.Lock()
+		defer h.connectMu.Unlock()
+		if h.connect[token] != pc {
+			return true
+		}
+		h.finishConnectLocked(token, pc, false)
+		return false
+	}
+
+	obj := map[string]any{
+		"type":     "connect",
+		"token":    token,
+		"uid":      sess.PlayerUID,
+		"username": username,
+		"readonly": lock == "",
+		"cheater":  cheater,
+	}
+	if password != "" {
+		obj["password"] = password
+		obj["nonce"] = nonce
+	}
+	if err := h.cfg.Listener.SendAtlasSigreq1(s.Addr, s.Key, obj); err != nil {
+		cancelConnect()
+		Error{Code: ErrorCodeBackendServiceUnavailable, Cause: fmt.Errorf("send connect token: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithDeadline(r.Context(), pc.Expires)
+	defer cancel()
+
+	var res connectResult
+	select {
+	case res = <-pc.Result:
+	case <-ctx.Done():
+		if cancelConnect() {
+			res = <-pc.Result // responded while we were timing out
+			break
+		}
+		if r.Context().Err() == nil {
+			Error{Code: ErrorCodeServerUnreachable, Message: "server did not respond to connect token"}.ServeHTTP(w, r)
+		}
+		return
+	}
+
+	if res.Err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: res.Err}.ServeHTTP(w, r)
+		return
+	}
+
+	h.recordServerPasswordResult(pkey, password != "", res)
+
+	obj = map[string]any{
+		"result": res.Result,
+	}
+	switch res.Result {
+	case "ok":
+		obj["addr"] = s.Addr.String()
+		obj["readonly"] = res.Readonly
+	case "reject":
+		obj["message"] = res.Message
+	case "password_required":
+		obj["nonce"] = res.Nonce
+	}
+	respondJSON(w, r, http.StatusOK, obj)
+}
+
+// handleConnectServerResponse responds to a connect token for the current
+// server.
+func (h *Handler) handleConnectServerResponse(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.requireServer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	id, token := r.PathValue("id"), r.PathValue("token")
+
+	h.serverMu.RLock()
+	_, err = h.ownServerLocked(id, sess.ID, sess.ServerAddr)
+	h.serverMu.RUnlock()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	res := connectResult{
+		Result: r.URL.Query().Get("result"),
+	}
+	data := r.URL.Query().Get("data")
+	if len(data) > maxConnectDataLength {
+		Error{Code: ErrorCodeBadRequest, Message: "data too long", Field: "data"}.ServeHTTP(w, r)
+		return
+	}
+	switch res.Result {
+	case "ok":
+	case "reject":
+		res.Message = data
+	case "password_required":
+		if data == "" {
+			Error{Code: ErrorCodeBadRequest, Message: "nonce is required", Field: "data"}.ServeHTTP(w, r)
+			return
+		}
+		res.Nonce = data
+	default:
+		Error{Code: ErrorCodeBadRequest, Message: "invalid result " + strconv.Quote(res.Result), Field: "result"}.ServeHTTP(w, r)
+		return
+	}
+
+	pc, err := h.takeConnect(token, id)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	obj := map[string]any{
+		"result": res.Result,
+		"uid":    pc.UID,
+	}
+	if res.Result == "ok" {
+		res.Readonly = true
+		if pc.Lock != "" {
+			lock, ok, err := h.transferPdataLock(r.Context(), pc.UID, pc.Lock, h.sessionDesc(r.Context(), sess))
+			if err != nil {
+				err = fmt.Errorf("transfer pdata lock: %w", err)
+				pc.Result <- connectResult{Err: err}
+				Error{Code: ErrorCodeInternalError, Cause: err}.ServeHTTP(w, r)
+				return
+			}
+			if ok {
+				res.Readonly = false
+				obj["pdata_lock"] = lock.Token
+			}
+		}
+		obj["readonly"] = res.Readonly
+	}
+	pc.Result <- res
+
+	respondJSON(w, r, http.StatusOK, obj)
+}
+
+// takeConnect removes the pending connect token for server id so the server's
+// response can be delivered to the player. It returns an error if the token is
+// unknown, expired, or was already used.
+func (h *Handler) takeConnect(token, id string) (*pendingConnect, error) {
+	h.connectMu.Lock()
+	defer h.connectMu.Unlock()
+
+	pc, ok := h.connect[token]
+	if !ok || pc.ServerID != id {
+		if x, ok := h.connectDone[token]; ok && x.ServerID == id {
+			if x.Responded {
+				return nil, Error{Code: ErrorCodeConnectTokenUsed}
+			}
+			return nil, Error{Code: ErrorCodeConnectTokenExpired, Message: "player stopped waiting"}
+		}
+		return nil, Error{Code: ErrorCodeConnectTokenExpired, Message: "unknown connect token"}
+	}
+	if time.Now().After(pc.Expires) {
+		h.finishConnectLocked(token, pc, false)
+		return nil, Error{Code: ErrorCodeConnectTokenExpired}
+	}
+	h.finishConnectLocked(token, pc, true)
+	return pc, nil
+}
@@ -0,0 +1,337 @@
+package atlas
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// connect connects the player to a server in the background.
+func (c *testClient) connect(t *testing.T, ctx context.Context, id, query string) <-chan map[string]any {
+	ch := make(chan map[string]any, 1)
+	go func() {
+		_, obj := c.do(t, ctx, "POST", "/server/"+id+"/connect?"+query, nil)
+		ch <- obj
+	}()
+	return ch
+}
+
+// respond responds to a connect token.
+func (c *testClient) respond(t *testing.T, id, token, query string) (int, map[string]any) {
+	t.Helper()
+	return c.do(t, context.Background(), "POST", "/server/"+id+"/connect/"+token+"?"+query, nil)
+}
+
+// pendingConnects returns the number of connect tokens waiting for a
+// response.
+func (h *Handler) pendingConnects() int {
+	h.connectMu.Lock()
+	defer h.connectMu.Unlock()
+	return len(h.connect)
+}
+
+func TestConnect(t *testing.T) {
+	h, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+	c := newTestPlayer(t, srv, 1)
+	s, g := newTestServer(t, srv)
+	id := s.registerServer(t)
+
+	t.Run("RequirePlayer", func(t *testing.T) {
+		if status, obj := s.do(t, context.Background(), "POST", "/server/"+id+"/connect", nil); errorCode(obj) != ErrorCodeAuthPlayerMissing {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodeAuthPlayerMissing, status, obj)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if status, obj := c.do(t, context.Background(), "POST", "/server/0000000000000000/connect", nil); status != http.StatusNotFound || errorCode(obj) != ErrorCodeServerNotFound {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodeServerNotFound, status, obj)
+		}
+	})
+
+	t.Run("InvalidLock", func(t *testing.T) {
+		if status, obj := c.do(t, context.Background(), "POST", "/server/"+id+"/connect?lock=wrong", nil); errorCode(obj) != ErrorCodePdataLocked {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodePdataLocked, status, obj)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		defer func(d time.Duration) { connectProbeTimeout = d }(connectProbeTimeout)
+		connectProbeTimeout = 200 * time.Millisecond
+
+		g.SetUnreachable(true)
+		defer g.SetUnreachable(false)
+
+		if res := <-c.connect(t, context.Background(), id, ""); errorCode(res) != ErrorCodeServerUnreachable {
+			t.Errorf("expected %s, got %v", ErrorCodeServerUnreachable, res)
+		}
+		select {
+		case req := <-g.reqs:
+			t.Errorf("expected no connect token to be sent to an unreachable server, got %v", req)
+		default:
+		}
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		lock := c.mustLock(t, "")
+		ch := c.connect(t, context.Background(), id, "lock="+lock)
+
+		req := g.Request(t)
+		if req["type"] != "connect" || req["uid"] != 1.0 || req["readonly"] != false {
+			t.Fatalf("unexpected connect request %v", req)
+		}
+		token := req["token"].(string)
+
+		status, obj := s.respond(t, id, token, "result=ok")
+		if status != http.StatusOK {
+			t.Fatalf("respond: status %d: %v", status, obj)
+		}
+		newLock, _ := obj["pdata_lock"].(string)
+		if newLock == "" || obj["readonly"] != false || obj["uid"] != 1.0 {
+			t.Errorf("expected the pdata lock to be transferred, got %v", obj)
+		}
+
+		res := <-ch
+		if res["result"] != "ok" || res["readonly"] != false || res["addr"] == "" {
+			t.Errorf("unexpected connect result %v", res)
+		}
+		if h.mustCheckLock(t, 1, lock) || !h.mustCheckLock(t, 1, newLock) {
+			t.Errorf("expected only the transferred lock token to be valid")
+		}
+		s.unlock(t, newLock)
+
+		if _, obj := s.respond(t, id, token, "result=ok"); errorCode(obj) != ErrorCodeConnectTokenUsed {
+			t.Errorf("expected %s for a duplicate response, got %v", ErrorCodeConnectTokenUsed, obj)
+		}
+	})
+
+	t.Run("Readonly", func(t *testing.T) {
+		ch := c.connect(t, context.Background(), id, "")
+
+		req := g.Request(t)
+		if req["readonly"] != true {
+			t.Fatalf("unexpected connect request %v", req)
+		}
+		status, obj := s.respond(t, id, req["token"].(string), "result=ok")
+		if status != http.StatusOK {
+			t.Fatalf("respond: status %d: %v", status, obj)
+		}
+		if _, ok := obj["pdata_lock"]; ok || obj["readonly"] != true {
+			t.Errorf("expected no pdata lock, got %v", obj)
+		}
+		if res := <-ch; res["result"] != "ok" || res["readonly"] != true {
+			t.Errorf("unexpected connect result %v", res)
+		}
+	})
+
+	t.Run("LockTakenOver", func(t *testing.T) {
+		lock := c.mustLock(t, "")
+		ch := c.connect(t, context.Background(), id, "lock="+lock)
+
+		req := g.Request(t)
+		other := c.mustLock(t, "timeout=0") // the lock changes hands before the server responds
+		status, obj := s.respond(t, id, req["token"].(string), "result=ok")
+		if status != http.StatusOK {
+			t.Fatalf("respond: status %d: %v", status, obj)
+		}
+		if _, ok := obj["pdata_lock"]; ok || obj["readonly"] != true {
+			t.Errorf("expected the connection to be read-only, got %v", obj)
+		}
+		if res := <-ch; res["result"] != "ok" || res["readonly"] != true {
+			t.Errorf("unexpected connect result %v", res)
+		}
+		if !h.mustCheckLock(t, 1, other) {
+			t.Errorf("expected the new lock holder to keep the lock")
+		}
+		c.unlock(t, other)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		ch := c.connect(t, context.Background(), id, "")
+
+		req := g.Request(t)
+		if status, obj := s.respond(t, id, req["token"].(string), "result=reject&data=full"); status != http.StatusOK {
+			t.Fatalf("respond: status %d: %v", status, obj)
+		}
+		if res := <-ch; res["result"] != "reject" || res["message"] != "full" {
+			t.Errorf("unexpected connect result %v", res)
+		}
+	})
+
+	t.Run("PasswordRequired", func(t *testing.T) {
+		ch := c.connect(t, context.Background(), id, "")
+
+		req := g.Request(t)
+		if _, obj := s.respond(t, id, req["token"].(string), "result=password_required"); errorCode(obj) != ErrorCodeBadRequest {
+			t.Errorf("expected %s for a missing nonce, got %v", ErrorCodeBadRequest, obj)
+		}
+		if status, obj := s.respond(t, id, req["token"].(string), "result=password_required&data=nonce"); status != http.StatusOK {
+			t.Fatalf("respond: status %d: %v", status, obj)
+		}
+		if res := <-ch; res["result"] != "password_required" || res["nonce"] != "nonce" {
+			t.Errorf("unexpected connect result %v", res)
+		}
+	})
+
+	t.Run("UnknownToken", func(t *testing.T) {
+		if _, obj := s.respond(t, id, "nonexistent", "result=ok"); errorCode(obj) != ErrorCodeConnectTokenExpired {
+			t.Errorf("expected %s, got %v", ErrorCodeConnectTokenExpired, obj)
+		}
+	})
+
+	t.Run("OtherServer", func(t *testing.T) {
+		ch := c.connect(t, context.Background(), id, "")
+		req := g.Request(t)
+
+		d, _ := newTestServer(t, srv)
+		otherID := d.registerServer(t)
+		if _, obj := d.respond(t, id, req["token"].(string), "result=ok"); errorCode(obj) != ErrorCodePermissionDenied {
+			t.Errorf("expected %s, got %v", ErrorCodePermissionDenied, obj)
+		}
+		if _, obj := d.respond(t, otherID, req["token"].(string), "result=ok"); errorCode(obj) != ErrorCodeConnectTokenExpired {
+			t.Errorf("expected %s, got %v", ErrorCodeConnectTokenExpired, obj)
+		}
+
+		s.respond(t, id, req["token"].(string), "result=reject")
+		<-ch
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		defer func(d time.Duration) { connectTimeout = d }(connectTimeout)
+		connectTimeout = 200 * time.Millisecond
+
+		lock := c.mustLock(t, "")
+		ch := c.connect(t, context.Background(), id, "lock="+lock)
+
+		req := g.Request(t)
+		if res := <-ch; errorCode(res) != ErrorCodeServerUnreachable {
+			t.Errorf("expected %s, got %v", ErrorCodeServerUnreachable, res)
+		}
+		waitFor(t, "connect token removal", func() bool { return h.pendingConnects() == 0 })
+
+		if _, obj := s.respond(t, id, req["token"].(string), "result=ok"); errorCode(obj) != ErrorCodeConnectTokenExpired {
+			t.Errorf("expected %s for a late response, got %v", ErrorCodeConnectTokenExpired, obj)
+		}
+		if !h.mustCheckLock(t, 1, lock) {
+			t.Errorf("expected the pdata lock not to be transferred")
+		}
+		c.unlock(t, lock)
+	})
+
+	t.Run("PlayerStoppedWaiting", func(t *testing.T) {
+		lock := c.mustLock(t, "")
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := c.connect(t, ctx, id, "lock="+lock)
+
+		req := g.Request(t)
+		cancel()
+		<-ch
+		waitFor(t, "connect token removal", func() bool { return h.pendingConnects() == 0 })
+
+		if _, obj := s.respond(t, id, req["token"].(string), "result=ok"); errorCode(obj) != ErrorCodeConnectTokenExpired {
+			t.Errorf("expected %s for a late response, got %v", ErrorCodeConnectTokenExpired, obj)
+		}
+		if !h.mustCheckLock(t, 1, lock) {
+			t.Errorf("expected the pdata lock not to be transferred")
+		}
+		c.unlock(t, lock)
+	})
+}
+
+// serverPasswordHMAC returns the password param for connecting to a server.
+func serverPasswordHMAC(nonce, password string) string {
+	m := hmac.New(sha256.New, []byte(nonce))
+	m.Write([]byte(password))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func TestConnectPassword(t *testing.T) {
+	_, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+	s, g := newTestServer(t, srv)
+	id := s.registerServer(t)
+
+	// challenge connects without a password, returning the nonce from the
+	// server
+	challenge := func(t *testing.T, c *testClient, nonce string) {
+		t.Helper()
+		ch := c.connect(t, context.Background(), id, "")
+		s.respond(t, id, g.Request(t)["token"].(string), "result=password_required&data="+nonce)
+		if res := <-ch; res["result"] != "password_required" || res["nonce"] != nonce {
+			t.Fatalf("unexpected connect result %v", res)
+		}
+	}
+
+	// attempt connects with a password, responding with result if the
+	// connection reaches the server
+	attempt := func(t *testing.T, c *testClient, nonce, password, result string) map[string]any {
+		t.Helper()
+		ch := c.connect(t, context.Background(), id, "password="+serverPasswordHMAC(nonce, password))
+		select {
+		case res := <-ch:
+			return res
+		case req := <-g.reqs:
+			if req["nonce"] != nonce || req["password"] != serverPasswordHMAC(nonce, password) {
+				t.Errorf("unexpected connect request %v", req)
+			}
+			s.respond(t, id, req["token"].(string), "result="+result)
+			return <-ch
+		}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 1)
+		challenge(t, c, "nonce1")
+		if res := attempt(t, c, "nonce1", "password", "ok"); res["result"] != "ok" {
+			t.Errorf("unexpected connect result %v", res)
+		}
+
+		// the nonce can only be used once
+		if res := attempt(t, c, "nonce1", "password", "ok"); errorCode(res) != ErrorCodeBadRequest {
+			t.Errorf("expected %s for a reused nonce, got %v", ErrorCodeBadRequest, res)
+		}
+	})
+
+	t.Run("NoChallenge", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 2)
+		if res := attempt(t, c, "nonce", "password", "ok"); errorCode(res) != ErrorCodeBadRequest {
+			t.Errorf("expected %s without a password challenge, got %v", ErrorCodeBadRequest, res)
+		}
+	})
+
+	t.Run("InvalidPassword", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 3)
+		challenge(t, c, "nonce")
+		if _, obj := c.do(t, context.Background(), "POST", "/server/"+id+"/connect?password=password", nil); errorCode(obj) != ErrorCodeBadRequest {
+			t.Errorf("expected %s for a non-hmac password, got %v", ErrorCodeBadRequest, obj)
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 4)
+		for i := range maxServerPasswordFailures {
+			nonce := "nonce" + strconv.Itoa(i)
+			challenge(t, c, nonce)
+			if res := attempt(t, c, nonce, "wrong", "reject"); res["result"] != "reject" {
+				t.Fatalf("attempt %d: unexpected connect result %v", i, res)
+			}
+		}
+
+		if res := attempt(t, c, "nonce", "password", "ok"); errorCode(res) != ErrorCodeServerPasswordRateLimited {
+			t.Errorf("expected %s, got %v", ErrorCodeServerPasswordRateLimited, res)
+		}
+		if res := <-c.connect(t, context.Background(), id, ""); errorCode(res) != ErrorCodeServerPasswordRateLimited {
+			t.Errorf("expected %s without a password, got %v", ErrorCodeServerPasswordRateLimited, res)
+		}
+
+		// other players aren't affected
+		d := newTestPlayer(t, srv, 5)
+		challenge(t, d, "nonce")
+		if res := attempt(t, d, "nonce", "password", "ok"); res["result"] != "ok" {
+			t.Errorf("unexpected connect result %v", res)
+		}
+	})
+}
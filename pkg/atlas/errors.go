@@ -15,16 +15,30 @@ const (
 	ErrorCodeAuthInvalid = "auth_invalid"
 
 	ErrorCodeAuthPlayerMissing   = "auth_player_missing"
+	ErrorCodeAuthPlayerFailed    = "auth_player_failed"
 	ErrorCodeAuthPlayerExpired   = "auth_player_expired"
 	ErrorCodeAuthPlayerDestroyed = "auth_player_destroyed"
 
 	ErrorCodeAuthServerMissing   = "auth_server_missing"
+	ErrorCodeAuthServerFailed    = "auth_server_failed"
 	ErrorCodeAuthServerExpired   = "auth_server_expired"
 	ErrorCodeAuthServerDestroyed = "auth_server_destroyed"
 
 	ErrorCodePdataLocked = "pdata_locked"
 
-	ErrorCodeServerNotFound = "server_not_found"
+	ErrorCodePermissionDenied = "permission_denied"
+
+	ErrorCodeServerNotFound    = "server_not_found"
+	ErrorCodeServerUnreachable = "server_unreachable"
+
+	ErrorCodeConnectTokenExpired = "connect_token_expired"
+	ErrorCodeConnectTokenUsed    = "connect_token_used"
+
+	ErrorCodeServerPasswordRateLimited = "server_password_rate_limited"
+
+	ErrorCodeBanned = "banned"
+
+	ErrorCodeRateLimited = "rate_limited"
 
 	ErrorCodeBackendServiceUnavailable = "backend_service_unavailable"
 
@@ -46,20 +60,38 @@ func (ec ErrorCode) String() string {
 		return "invalid session token"
 	case ErrorCodeAuthPlayerMissing:
 		return "current session does not have an authenticated player"
+	case ErrorCodeAuthPlayerFailed:
+		return "player authentication failed"
 	case ErrorCodeAuthPlayerExpired:
 		return "current session player authentication expired"
 	case ErrorCodeAuthPlayerDestroyed:
 		return "current session player authentication destroyed"
 	case ErrorCodeAuthServerMissing:
 		return "current session does not have a verified server"
+	case ErrorCodeAuthServerFailed:
+		return "server verification failed"
 	case ErrorCodeAuthServerExpired:
 		return "current session server verification expired"
 	case ErrorCodeAuthServerDestroyed:
 		return "current session server verification destroyed"
 	case ErrorCodePdataLocked:
 		return "pdata is locked"
+	case ErrorCodePermissionDenied:
+		return "permission denied"
 	case ErrorCodeServerNotFound:
 		return "server not found"
+	case ErrorCodeServerUnreachable:
+		return "server unreachable"
+	case ErrorCodeConnectTokenExpired:
+		return "connect token expired"
+	case ErrorCodeConnectTokenUsed:
+		return "connect token already used"
+	case ErrorCodeServerPasswordRateLimited:
+		return "too many failed password attempts"
+	case ErrorCodeBanned:
+		return "banned"
+	case ErrorCodeRateLimited:
+		return "too many requests"
 	case ErrorCodeBackendServiceUnavailable:
 		return "backend service unavailable"
 	case ErrorCodeBadRequest:
@@ -83,20 +115,38 @@ func (ec ErrorCode) Explanation() string {
 		return "the client must be restarted since the provided session token does not exist or is no longer valid"
 	case ErrorCodeAuthPlayerMissing:
 		return "the client must authenticate the player for this kind of request"
+	case ErrorCodeAuthPlayerFailed:
+		return "the client must get a new token for the player authentication method and try again"
 	case ErrorCodeAuthPlayerExpired:
 		return "the client must re-authenticate the player since the authentication has timed out"
 	case ErrorCodeAuthPlayerDestroyed:
 		return "the client must be restarted since another client has authenticated the current player"
 	case ErrorCodeAuthServerMissing:
 		return "the client must verify the server for this kind of request"
+	case ErrorCodeAuthServerFailed:
+		return "the client must start verifying the server again since the verification token is invalid or has expired"
 	case ErrorCodeAuthServerExpired:
 		return "the client must re-verify the server since the verification has timed out"
 	case ErrorCodeAuthServerDestroyed:
 		return "the client must be restarted since another server has verified with the current ip/port"
 	case ErrorCodePdataLocked:
 		return "the client should log an error since the pdata operation did not succeed since the client is not currently holding the write lock for pdata"
+	case ErrorCodePermissionDenied:
+		return "the client is authenticated, but is not allowed to do this (this is probably a northstar bug)"
 	case ErrorCodeServerNotFound:
 		return "the client should log an error (or if it is the server itself, attempt to register again) since the server id is not known"
+	case ErrorCodeServerUnreachable:
+		return "the client should try again later or choose another server since the game server did not respond"
+	case ErrorCodeConnectTokenExpired:
+		return "the server should drop the connection attempt since the player is no longer waiting for a response"
+	case ErrorCodeConnectTokenUsed:
+		return "the server should ignore the duplicate response since the connect token has already been responded to"
+	case ErrorCodeServerPasswordRateLimited:
+		return "the client should wait before trying the server password again since there have been too many failed attempts"
+	case ErrorCodeBanned:
+		return "the client should show the reason to the user and should not try again since the player, ip, or server is banned"
+	case ErrorCodeRateLimited:
+		return "the client should wait for the number of seconds in the Retry-After header before trying again"
 	case ErrorCodeBackendServiceUnavailable:
 		return "the client should try again later since a required backend service was unavailable"
 	case ErrorCodeBadRequest:
@@ -120,20 +170,38 @@ func (ec ErrorCode) StatusCode() int {
 		return http.StatusForbidden
 	case ErrorCodeAuthPlayerMissing:
 		return http.StatusUnauthorized
+	case ErrorCodeAuthPlayerFailed:
+		return http.StatusUnauthorized
 	case ErrorCodeAuthPlayerExpired:
 		return http.StatusUnauthorized
 	case ErrorCodeAuthPlayerDestroyed:
 		return http.StatusForbidden
 	case ErrorCodeAuthServerMissing:
 		return http.StatusUnauthorized
+	case ErrorCodeAuthServerFailed:
+		return http.StatusUnauthorized
 	case ErrorCodeAuthServerExpired:
 		return http.StatusUnauthorized
 	case ErrorCodeAuthServerDestroyed:
 		return http.StatusForbidden
 	case ErrorCodePdataLocked:
 		return http.StatusUnauthorized
+	case ErrorCodePermissionDenied:
+		return http.StatusForbidden
 	case ErrorCodeServerNotFound:
 		return http.StatusNotFound
+	case ErrorCodeServerUnreachable:
+		return http.StatusGatewayTimeout
+	case ErrorCodeConnectTokenExpired:
+		return http.StatusGone
+	case ErrorCodeConnectTokenUsed:
+		return http.StatusConflict
+	case ErrorCodeServerPasswordRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorCodeBanned:
+		return http.StatusForbidden
+	case ErrorCodeRateLimited:
+		return http.StatusTooManyRequests
 	case ErrorCodeBackendServiceUnavailable:
 		return http.StatusServiceUnavailable
 	case ErrorCodeBadRequest:
@@ -153,6 +221,7 @@ type Error struct {
 	Code    ErrorCode
 	Cause   error // not shown to clients
 	Message string
+	Field   string // optional, for errors about a specific request field
 }
 
 func (e Error) Error() string {
@@ -165,6 +234,11 @@ func (e Error) Error() string {
 		b.WriteString(": ")
 		b.WriteString(e.Message)
 	}
+	if e.Field != "" {
+		b.WriteString(" (field: ")
+		b.WriteString(e.Field)
+		b.WriteString(")")
+	}
 	if e.Cause != nil {
 		b.WriteString(" (cause: ")
 		b.WriteString(e.Cause.Error())
@@ -187,6 +261,11 @@ func (e Error) ClientError() string {
 		b.WriteString(": ")
 		b.WriteString(e.Message)
 	}
+	if e.Field != "" {
+		b.WriteString(" (field: ")
+		b.WriteString(e.Field)
+		b.WriteString(")")
+	}
 	if e.Cause != nil {
 		b.WriteString(" (explanation: ")
 		b.WriteString(e.Code.Explanation())
@@ -204,6 +283,9 @@ func (e Error) MarshalJSON() ([]byte, error) {
 	} else {
 		b = jsonx.AppendString(append(jsonx.AppendString(append(b, ','), "error"), ':'), e.Code.String()+": "+e.Message)
 	}
+	if e.Field != "" {
+		b = jsonx.AppendString(append(jsonx.AppendString(append(b, ','), "field"), ':'), e.Field)
+	}
 	if e.Code.Explanation() != "" {
 		b = jsonx.AppendString(append(jsonx.AppendString(append(b, ','), "explanation"), ':'), e.Code.Explanation())
 	}
@@ -214,6 +296,7 @@ func (e Error) MarshalJSON() ([]byte, error) {
 
 func (e Error) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	buf, _ := e.MarshalJSON()
+	setErrorCode(w, e.Code)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
 	w.WriteHeader(e.Code.StatusCode())
@@ -0,0 +1,278 @@
+package atlas
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// httpDurationBuckets are the upper bounds of the request duration histogram
+// buckets in seconds.
+var httpDurationBuckets = [...]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// httpRequestKey identifies a request counter.
+type httpRequestKey struct {
+	Route  string
+	Status int
+	Error  ErrorCode
+}
+
+// httpDurationKey identifies a request duration histogram.
+type httpDurationKey struct {
+	Route string
+	Error ErrorCode
+}
+
+// httpDuration is a request duration histogram.
+type httpDuration struct {
+	bucket [len(httpDurationBuckets)]atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64 // nanoseconds
+}
+
+// httpMetrics contains metrics for HTTP requests.
+type httpMetrics struct {
+	mu       sync.RWMutex
+	requests map[httpRequestKey]*atomic.Uint64
+	duration map[httpDurationKey]*httpDuration
+}
+
+// metricsResponseWriter records the response status and error code for a
+// request.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	code   ErrorCode
+}
+
+func (w *metricsResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setErrorCode records the error code for the response if w is a
+// metricsResponseWriter.
+func setErrorCode(w http.ResponseWriter, code ErrorCode) {
+	if mw, ok := w.(*metricsResponseWriter); ok {
+		mw.code = code
+	}
+}
+
+// record records a request.
+func (m *httpMetrics) record(route string, status int, code ErrorCode, d time.Duration) {
+	if route == "" {
+		route = "other"
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	key := httpRequestKey{route, status, code}
+	dkey := httpDurationKey{route, code}
+
+	m.mu.RLock()
+	c, ok1 := m.requests[key]
+	h, ok2 := m.duration[dkey]
+	m.mu.RUnlock()
+
+	if !ok1 || !ok2 {
+		m.mu.Lock()
+		if m.requests == nil {
+			m.requests = make(map[httpRequestKey]*atomic.Uint64)
+			m.duration = make(map[httpDurationKey]*httpDuration)
+		}
+		if c, ok1 = m.requests[key]; !ok1 {
+			c = new(atomic.Uint64)
+			m.requests[key] = c
+		}
+		if h, ok2 = m.duration[dkey]; !ok2 {
+			h = new(httpDuration)
+			m.duration[dkey] = h
+		}
+		m.mu.Unlock()
+	}
+
+	c.Add(1)
+	for i, le := range httpDurationBuckets {
+		if d.Seconds() <= le {
+			h.bucket[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(uint64(d))
+}
+
+func (m *httpMetrics) writePrometheus(w io.Writer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]httpRequestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b httpRequestKey) int {
+		return cmp.Or(
+			strings.Compare(a.Route, b.Route),
+			cmp.Compare(a.Status, b.Status),
+			strings.Compare(string(a.Error), string(b.Error)),
+		)
+	})
+	promHeader(w, "atlas_http_request_count", "counter", "HTTP requests by route, status, and error code.")
+	for _, k := range keys {
+		fmt.Fprintln(w, `atlas_http_request_count{route=`+promLabel(k.Route)+`,status="`+strconv.Itoa(k.Status)+`",error=`+promLabel(string(k.Error))+`}`, m.requests[k].Load())
+	}
+
+	dkeys := make([]httpDurationKey, 0, len(m.duration))
+	for k := range m.duration {
+		dkeys = append(dkeys, k)
+	}
+	slices.SortFunc(dkeys, func(a, b httpDurationKey) int {
+		return cmp.Or(
+			strings.Compare(a.Route, b.Route),
+			strings.Compare(string(a.Error), string(b.Error)),
+		)
+	})
+	promHeader(w, "atlas_http_request_duration_seconds", "histogram", "HTTP request duration by route and error code.")
+	for _, k := range dkeys {
+		h := m.duration[k]
+		labels := `route=` + promLabel(k.Route) + `,error=` + promLabel(string(k.Error))
+		for i, le := range httpDurationBuckets {
+			fmt.Fprintln(w, `atlas_http_request_duration_seconds_bucket{`+labels+`,le="`+strconv.FormatFloat(le, 'f', -1, 64)+`"}`, h.bucket[i].Load())
+		}
+		fmt.Fprintln(w, `atlas_http_request_duration_seconds_bucket{`+labels+`,le="+Inf"}`, h.count.Load())
+		fmt.Fprintln(w, `atlas_http_request_duration_seconds_sum{`+labels+`}`, time.Duration(h.sum.Load()).Seconds())
+		fmt.Fprintln(w, `atlas_http_request_duration_seconds_count{`+labels+`}`, h.count.Load())
+	}
+}
+
+// promHeader writes the prometheus HELP and TYPE lines for a metric family.
+func promHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintln(w, "# HELP", name, help)
+	fmt.Fprintln(w, "# TYPE", name, typ)
+}
+
+// promLabel quotes a prometheus label value.
+func promLabel(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// namedDBStats is a database connection pool with a name for the db label.
+type namedDBStats struct {
+	Name  string
+	Stats sql.DBStats
+}
+
+// writeDBStats writes prometheus metrics for database connection pools.
+func writeDBStats(w io.Writer, dbs ...namedDBStats) {
+	for _, m := range []struct {
+		Name  string
+		Type  string
+		Help  string
+		Value func(s sql.DBStats) any
+	}{
+		{"atlas_sql_max_open_connections", "gauge", "Maximum number of open database connections.", func(s sql.DBStats) any { return s.MaxOpenConnections }},
+		{"atlas_sql_open_connections", "gauge", "Number of open database connections.", func(s sql.DBStats) any { return s.OpenConnections }},
+		{"atlas_sql_in_use_connections", "gauge", "Number of database connections in use.", func(s sql.DBStats) any { return s.InUse }},
+		{"atlas_sql_idle_connections", "gauge", "Number of idle database connections.", func(s sql.DBStats) any { return s.Idle }},
+		{"atlas_sql_wait_count", "counter", "Number of waits for a database connection.", func(s sql.DBStats) any { return s.WaitCount }},
+		{"atlas_sql_wait_duration_seconds", "counter", "Total time waited for a database connection.", func(s sql.DBStats) any { return s.WaitDuration.Seconds() }},
+		{"atlas_sql_max_idle_closed_count", "counter", "Database connections closed due to the idle connection limit.", func(s sql.DBStats) any { return s.MaxIdleClosed }},
+		{"atlas_sql_max_idle_time_closed_count", "counter", "Database connections closed due to the idle time limit.", func(s sql.DBStats) any { return s.MaxIdleTimeClosed }},
+		{"atlas_sql_max_lifetime_closed_count", "counter", "Database connections closed due to the lifetime limit.", func(s sql.DBStats) any { return s.MaxLifetimeClosed }},
+	} {
+		promHeader(w, m.Name, m.Type, m.Help)
+		for _, db := range dbs {
+			fmt.Fprintln(w, m.Name+`{db=`+promLabel(db.Name)+`}`, m.Value(db.Stats))
+		}
+	}
+}
+
+// writeServerMetrics writes metrics for registered servers.
+func (h *Handler) writeServerMetrics(w io.Writer) {
+	h.serverMu.RLock()
+	now := time.Now()
+	regions := map[string]int{}
+	for _, s := range h.servers {
+		if !h.serverExpired(s, now) {
+			regions[s.Region]++
+		}
+	}
+	subs := len(h.serverSubs)
+	h.serverMu.RUnlock()
+
+	names := make([]string, 0, len(regions))
+	for region := range regions {
+		names = append(names, region)
+	}
+	slices.Sort(names)
+
+	promHeader(w, "atlas_servers", "gauge", "Registered servers by region.")
+	for _, region := range names {
+		fmt.Fprintln(w, `atlas_servers{region=`+promLabel(region)+`}`, regions[region])
+	}
+	promHeader(w, "atlas_server_stream_subscribers", "gauge", "Server list stream subscribers.")
+	fmt.Fprintln(w, `atlas_server_stream_subscribers`, subs)
+}
+
+// writeSessionMetrics writes metrics for sessions and pdata locks.
+func (h *Handler) writeSessionMetrics(ctx context.Context, w io.Writer) {
+	cnt, err := h.cfg.SessionStorage.Count(ctx)
+	if err != nil {
+		h.cfg.Logger.Warn("failed to count sessions for metrics", "error", err)
+		return
+	}
+	promHeader(w, "atlas_sessions", "gauge", "Sessions by type.")
+	fmt.Fprintln(w, `atlas_sessions{type="session"}`, cnt.Sessions)
+	fmt.Fprintln(w, `atlas_sessions{type="player"}`, cnt.PlayerSessions)
+	fmt.Fprintln(w, `atlas_sessions{type="server"}`, cnt.ServerSessions)
+	promHeader(w, "atlas_pdata_locks", "gauge", "Held pdata locks.")
+	fmt.Fprintln(w, `atlas_pdata_locks`, cnt.PdataLocks)
+}
+
+// handleMetrics writes prometheus text metrics.
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.AdminToken != "" {
+		if subtle.ConstantTimeCompare([]byte(sessionToken(r)), []byte(h.cfg.AdminToken)) != 1 {
+			Error{Code: ErrorCodePermissionDenied, Message: "invalid admin token"}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	var b bytes.Buffer
+	h.writePrometheus(r.Context(), &b)
+
+	w.Header().Set("Cache-Control", "private, no-cache, no-store")
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
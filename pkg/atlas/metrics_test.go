@@ -0,0 +1,99 @@
+package atlas
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// getMetrics gets the prometheus metrics with the provided admin token,
+// returning the status code and body.
+func getMetrics(t *testing.T, c *testClient) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", c.srv.URL+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("get metrics: read body: %v", err)
+	}
+	return resp.StatusCode, string(buf)
+}
+
+func TestMetrics(t *testing.T) {
+	_, srv := newTestHandler(t, Config{AdminToken: "admin"})
+
+	if status, _ := getMetrics(t, &testClient{srv: srv, token: "wrong"}); status != http.StatusForbidden {
+		t.Errorf("expected 403 for an invalid admin token, got status %d", status)
+	}
+
+	c := newTestPlayer(t, srv, 1)
+	c.do(t, context.Background(), "GET", "/pdata/1", nil)
+	(&testClient{srv: srv, token: "invalid"}).do(t, context.Background(), "GET", "/pdata/1", nil)
+
+	status, metrics := getMetrics(t, &testClient{srv: srv, token: "admin"})
+	if status != http.StatusOK {
+		t.Fatalf("get metrics: status %d", status)
+	}
+	lines := strings.Split(metrics, "\n")
+
+	t.Run("Duration", func(t *testing.T) {
+		for _, code := range []ErrorCode{"", ErrorCodeAuthInvalid} {
+			prefix := `atlas_http_request_duration_seconds_count{route="GET /pdata/{uid}",error="` + string(code) + `"} `
+			if !containsLine(lines, prefix+"1") {
+				t.Errorf("expected a duration histogram for error code %q", code)
+			}
+		}
+	})
+
+	t.Run("Families", func(t *testing.T) {
+		typed := map[string]bool{}
+		for _, line := range lines {
+			if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+				name, _, _ = strings.Cut(name, " ")
+				if typed[name] {
+					t.Errorf("duplicate TYPE line for %s", name)
+				}
+				typed[name] = true
+			}
+		}
+		for _, line := range lines {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, _, _ := strings.Cut(line, " ")
+			name, _, _ = strings.Cut(name, "{")
+			family := name
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if base, ok := strings.CutSuffix(name, suffix); ok && typed[base] {
+					family = base
+				}
+			}
+			if !typed[family] {
+				t.Errorf("missing TYPE line for %s", name)
+			}
+		}
+	})
+}
+
+// containsLine checks whether lines contains s.
+func containsLine(lines []string, s string) bool {
+	for _, line := range lines {
+		if line == s {
+			return true
+		}
+	}
+	return false
+}
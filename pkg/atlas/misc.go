@@ -1,5 +1,267 @@
 package atlas
 
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// promosCheckInterval is how often the main menu promos file is checked
+	// for changes.
+	promosCheckInterval = 5 * time.Second
+
+	// maxPromosSize is the maximum size of the main menu promos file.
+	maxPromosSize = 64 << 10
+)
+
+// mainMenuPromos is the main menu promos response expected by Northstar.
+type mainMenuPromos struct {
+	NewInfo      *mainMenuPromosNewInfo     `json:"newInfo"`
+	LargeButton  *mainMenuPromosButtonLarge `json:"largeButton"`
+	SmallButton1 *mainMenuPromosButtonSmall `json:"smallButton1"`
+	SmallButton2 *mainMenuPromosButtonSmall `json:"smallButton2"`
+}
+
+type mainMenuPromosNewInfo struct {
+	Title1 string `json:"Title1"`
+	Title2 string `json:"Title2"`
+	Title3 string `json:"Title3"`
+}
+
+type mainMenuPromosButtonLarge struct {
+	Title      string `json:"Title"`
+	Text       string `json:"Text"`
+	Url        string `json:"Url"`
+	ImageIndex int    `json:"ImageIndex"`
+}
+
+type mainMenuPromosButtonSmall struct {
+	Title      string `json:"Title"`
+	Url        string `json:"Url"`
+	ImageIndex int    `json:"ImageIndex"`
+}
+
+// promos is a rendered main menu promos response.
+type promos struct {
+	ModTime time.Time // of the file, or zero if it doesn't exist
+	Size    int64
+	ETag    string
+	Buf     []byte
+}
+
 func (h *Handler) initMisc() error {
+	if h.cfg.MainMenuPromos == "" {
+		p, err := renderPromos(defaultMainMenuPromos())
+		if err != nil {
+			return fmt.Errorf("render default main menu promos: %w", err)
+		}
+		h.promos.Store(p)
+	} else if err := h.ReloadPromos(); err != nil {
+		return err
+	}
+	h.cfg.Mux.HandleFunc("GET /mainmenupromos", h.handleMainMenuPromos)
+	h.cfg.Mux.HandleFunc("GET /metrics", h.handleMetrics)
+	return nil
+}
+
+// defaultMainMenuPromos returns empty main menu promos.
+func defaultMainMenuPromos() mainMenuPromos {
+	return mainMenuPromos{
+		NewInfo:      new(mainMenuPromosNewInfo),
+		LargeButton:  new(mainMenuPromosButtonLarge),
+		SmallButton1: new(mainMenuPromosButtonSmall),
+		SmallButton2: new(mainMenuPromosButtonSmall),
+	}
+}
+
+// parseMainMenuPromos parses and validates main menu promos.
+func parseMainMenuPromos(r io.Reader) (mainMenuPromos, error) {
+	var m mainMenuPromos
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return m, fmt.Errorf("unexpected data after main menu promos")
+	}
+
+	switch {
+	case m.NewInfo == nil:
+		return m, fmt.Errorf("newInfo is required")
+	case m.LargeButton == nil:
+		return m, fmt.Errorf("largeButton is required")
+	case m.SmallButton1 == nil:
+		return m, fmt.Errorf("smallButton1 is required")
+	case m.SmallButton2 == nil:
+		return m, fmt.Errorf("smallButton2 is required")
+	}
+	if err := validatePromoButton(m.LargeButton.Url, m.LargeButton.ImageIndex); err != nil {
+		return m, fmt.Errorf("largeButton: %w", err)
+	}
+	if err := validatePromoButton(m.SmallButton1.Url, m.SmallButton1.ImageIndex); err != nil {
+		return m, fmt.Errorf("smallButton1: %w", err)
+	}
+	if err := validatePromoButton(m.SmallButton2.Url, m.SmallButton2.ImageIndex); err != nil {
+		return m, fmt.Errorf("smallButton2: %w", err)
+	}
+	return m, nil
+}
+
+// validatePromoButton validates the link and image of a main menu promo
+// button.
+func validatePromoButton(link string, image int) error {
+	if link != "" {
+		if u, err := url.Parse(link); err != nil {
+			return fmt.Errorf("Url: %w", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Url: must be an absolute http or https url")
+		}
+	}
+	if image < 0 {
+		return fmt.Errorf("ImageIndex: must not be negative")
+	}
+	return nil
+}
+
+// renderPromos renders a main menu promos response.
+func renderPromos(m mainMenuPromos) (*promos, error) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(buf)
+	return &promos{
+		ETag: `"` + hex.EncodeToString(hash[:16]) + `"`,
+		Buf:  buf,
+	}, nil
+}
+
+// loadPromos loads main menu promos from the file at name. If it doesn't
+// exist, empty promos are returned.
+func loadPromos(name string) (*promos, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return renderPromos(defaultMainMenuPromos())
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > maxPromosSize {
+		return nil, fmt.Errorf("file too large")
+	}
+
+	m, err := parseMainMenuPromos(io.LimitReader(f, maxPromosSize))
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	p, err := renderPromos(m)
+	if err != nil {
+		return nil, err
+	}
+	p.ModTime = fi.ModTime()
+	p.Size = fi.Size()
+	return p, nil
+}
+
+// ReloadPromos reloads the main menu promos file. If it is invalid, the
+// current promos continue to be served. It does nothing if main menu promos
+// are not configured.
+func (h *Handler) ReloadPromos() error {
+	if h.cfg.MainMenuPromos == "" {
+		return nil
+	}
+
+	h.promosMu.Lock()
+	defer h.promosMu.Unlock()
+
+	p, err := loadPromos(h.cfg.MainMenuPromos)
+	if err != nil {
+		return fmt.Errorf("load main menu promos from %q: %w", h.cfg.MainMenuPromos, err)
+	}
+	if old := h.promos.Load(); old == nil || old.ETag != p.ETag {
+		h.cfg.Logger.Info("loaded main menu promos", "file", h.cfg.MainMenuPromos, "etag", p.ETag)
+	}
+	h.promos.Store(p)
 	return nil
 }
+
+// runPromosWatcher reloads the main menu promos file when it changes.
+func (h *Handler) runPromosWatcher(ctx context.Context) {
+	if h.cfg.MainMenuPromos == "" {
+		return
+	}
+
+	// the last version we tried to load, so we don't keep retrying (and
+	// logging errors for) the same invalid file
+	var lastMod time.Time
+	var lastSize int64
+	if p := h.promos.Load(); p != nil {
+		lastMod, lastSize = p.ModTime, p.Size
+	}
+
+	t := time.NewTicker(promosCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		var mod time.Time
+		var size int64
+		if fi, err := os.Stat(h.cfg.MainMenuPromos); err == nil {
+			mod, size = fi.ModTime(), fi.Size()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if mod.Equal(lastMod) && size == lastSize {
+			continue
+		}
+		lastMod, lastSize = mod, size
+
+		if err := h.ReloadPromos(); err != nil {
+			h.cfg.Logger.Warn("failed to reload main menu promos", "error", err)
+		}
+	}
+}
+
+// handleMainMenuPromos gets the main menu promos.
+func (h *Handler) handleMainMenuPromos(w http.ResponseWriter, r *http.Request) {
+	p := h.promos.Load()
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("ETag", p.ETag)
+
+	if matchETag(r, p.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(p.Buf)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(p.Buf)
+	}
+}
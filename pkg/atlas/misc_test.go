@@ -0,0 +1,140 @@
+package atlas
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// getPromos gets the main menu promos, returning the status code, ETag, and
+// large button title (if the promos were returned).
+func getPromos(t *testing.T, c *testClient, etag string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", c.srv.URL+"/mainmenupromos", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("get main menu promos: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var title string
+	if resp.StatusCode == http.StatusOK {
+		var obj mainMenuPromos
+		if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+			t.Fatalf("decode main menu promos: %v", err)
+		}
+		title = obj.LargeButton.Title
+	}
+	return resp.StatusCode, resp.Header.Get("ETag"), title
+}
+
+// testPromos returns main menu promos json with the provided large button
+// title and url.
+func testPromos(title, url string) string {
+	return `{
+		"newInfo": {"Title1": "", "Title2": "", "Title3": ""},
+		"largeButton": {"Title": "` + title + `", "Text": "", "Url": "` + url + `", "ImageIndex": 1},
+		"smallButton1": {"Title": "", "Url": "", "ImageIndex": 0},
+		"smallButton2": {"Title": "", "Url": "", "ImageIndex": 0}
+	}`
+}
+
+func TestMainMenuPromos(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		_, srv := newTestHandler(t, Config{})
+		if status, _, title := getPromos(t, &testClient{srv: srv}, ""); status != http.StatusOK || title != "" {
+			t.Errorf("expected empty promos, got status %d, title %q", status, title)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		h, _ := newTestHandler(t, Config{})
+		name := filepath.Join(t.TempDir(), "mainmenupromos.json")
+		for _, tc := range []struct {
+			Name  string
+			Promo string
+		}{
+			{"Syntax", `{`},
+			{"Missing", `{"newInfo": {}}`},
+			{"UnknownField", strings.Replace(testPromos("", ""), `"Text"`, `"Other"`, 1)},
+			{"RelativeURL", testPromos("", "/example")},
+			{"NonHTTPURL", testPromos("", "javascript:alert(1)")},
+			{"Trailing", testPromos("", "") + `{}`},
+		} {
+			if err := os.WriteFile(name, []byte(tc.Promo), 0666); err != nil {
+				t.Fatalf("write promos: %v", err)
+			}
+			cfg := h.cfg
+			cfg.Mux = nil
+			cfg.MainMenuPromos = name
+			if _, err := New(cfg); err == nil {
+				t.Errorf("%s: expected error for invalid promos", tc.Name)
+			}
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "mainmenupromos.json")
+		write := func(promos string) {
+			if err := os.WriteFile(name, []byte(promos), 0666); err != nil {
+				t.Fatalf("write promos: %v", err)
+			}
+		}
+
+		// a missing file serves empty promos
+		h, srv := newTestHandler(t, Config{MainMenuPromos: name})
+		c := &testClient{srv: srv}
+		if status, _, title := getPromos(t, c, ""); status != http.StatusOK || title != "" {
+			t.Errorf("expected empty promos, got status %d, title %q", status, title)
+		}
+
+		write(testPromos("first", "https://northstar.tf"))
+		if err := h.ReloadPromos(); err != nil {
+			t.Fatalf("reload promos: %v", err)
+		}
+		status, etag, title := getPromos(t, c, "")
+		if status != http.StatusOK || title != "first" || etag == "" {
+			t.Errorf("expected first promos, got status %d, title %q", status, title)
+		}
+		if status, _, _ := getPromos(t, c, etag); status != http.StatusNotModified {
+			t.Errorf("expected 304, got status %d", status)
+		}
+
+		// invalid promos are ignored
+		write(testPromos("invalid", "ftp://northstar.tf"))
+		if err := h.ReloadPromos(); err == nil {
+			t.Errorf("expected error reloading invalid promos")
+		}
+		if status, _, _ := getPromos(t, c, etag); status != http.StatusNotModified {
+			t.Errorf("expected the old promos to be kept, got status %d", status)
+		}
+
+		write(testPromos("second", ""))
+		if err := h.ReloadPromos(); err != nil {
+			t.Fatalf("reload promos: %v", err)
+		}
+		if status, newETag, title := getPromos(t, c, etag); status != http.StatusOK || title != "second" || newETag == etag {
+			t.Errorf("expected second promos with a new ETag, got status %d, title %q", status, title)
+		}
+
+		// removing the file goes back to empty promos
+		if err := os.Remove(name); err != nil {
+			t.Fatalf("remove promos: %v", err)
+		}
+		if err := h.ReloadPromos(); err != nil {
+			t.Fatalf("reload promos: %v", err)
+		}
+		if _, _, title := getPromos(t, c, ""); title != "" {
+			t.Errorf("expected empty promos, got title %q", title)
+		}
+	})
+}
@@ -1,5 +1,327 @@
 package atlas
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+)
+
+// maxPdataSize is the maximum size of uploaded pdata.
+const maxPdataSize = 256 << 10
+
+var defaultPdataHash = sha256.Sum256(pdata.DefaultPdata)
+
 func (h *Handler) initPdata() error {
+	h.cfg.Mux.HandleFunc("GET /pdata/{uid}", h.handleGetPdata)
+	h.cfg.Mux.HandleFunc("PUT /pdata/{uid}", h.handlePutPdata)
+	h.cfg.Mux.HandleFunc("DELETE /pdata/{uid}", h.handleDeletePdata)
+	h.cfg.Mux.HandleFunc("GET /pdata/{uid}/lock", h.handleGetPdataLock)
+	h.cfg.Mux.HandleFunc("POST /pdata/{uid}/lock", h.handlePostPdataLock)
+	h.cfg.Mux.HandleFunc("DELETE /pdata/{uid}/lock", h.handleDeletePdataLock)
 	return nil
 }
+
+// pathUID gets the uid path value.
+func pathUID(r *http.Request) (uint64, error) {
+	uid, err := strconv.ParseUint(r.PathValue("uid"), 10, 64)
+	if err != nil || uid == 0 {
+		return 0, Error{Code: ErrorCodeBadRequest, Message: "invalid uid"}
+	}
+	return uid, nil
+}
+
+// pdataFormat gets the requested pdata format (raw or json) from the format
+// url param, falling back to the Accept header.
+func pdataFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case "raw", "json":
+		return f, nil
+	case "":
+	default:
+		return "", Error{Code: ErrorCodeBadRequest, Message: "invalid pdata format " + strconv.Quote(f)}
+	}
+
+	format, formatQ := "raw", -1.0
+	for _, x := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, _ := strings.Cut(x, ";")
+
+		var f string
+		switch strings.ToLower(strings.TrimSpace(mt)) {
+		case "application/octet-stream":
+			f = "raw"
+		case "application/json":
+			f = "json"
+		default:
+			continue
+		}
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if v, err := strconv.ParseFloat(v, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 && q > formatQ {
+			format, formatQ = f, q
+		}
+	}
+	return format, nil
+}
+
+// pdataETag returns the strong ETag for pdata with the provided hash and format.
+func pdataETag(hash [sha256.Size]byte, format string) string {
+	if format == "raw" {
+		return `"` + hex.EncodeToString(hash[:]) + `"`
+	}
+	return `"` + hex.EncodeToString(hash[:]) + `-` + format + `"`
+}
+
+// matchETag checks if the If-None-Match header of r matches etag.
+func matchETag(r *http.Request, etag string) bool {
+	for _, x := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if x = strings.TrimSpace(x); x == etag || x == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGetPdata gets pdata.
+func (h *Handler) handleGetPdata(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	format, err := pdataFormat(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if _, err := h.requireSession(r); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if token := r.URL.Query().Get("lock"); token != "" {
+		if ok, err := h.checkPdataLock(r.Context(), uid, token); err != nil {
+			respondError(w, r, err)
+			return
+		} else if !ok {
+			Error{Code: ErrorCodePdataLocked}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", "Accept")
+
+	if r.Header.Get("If-None-Match") != "" {
+		hash, exists, err := h.cfg.PdataStorage.GetPdataHash(uid)
+		if err != nil {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get pdata hash: %w", err)}.ServeHTTP(w, r)
+			return
+		}
+		if !exists {
+			hash = defaultPdataHash
+		}
+		if etag := pdataETag(hash, format); matchETag(r, etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	buf, exists, err := h.cfg.PdataStorage.GetPdataCached(uid, [sha256.Size]byte{})
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get pdata: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+	if !exists {
+		buf = pdata.DefaultPdata
+	}
+	etag := pdataETag(sha256.Sum256(buf), format)
+
+	switch format {
+	case "raw":
+		w.Header().Set("Content-Type", "application/octet-stream")
+	case "json":
+		var pd pdata.Pdata
+		if err := pd.UnmarshalBinary(buf); err != nil {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("decode pdata: %w", err)}.ServeHTTP(w, r)
+			return
+		}
+		if buf, err = pd.MarshalJSON(); err != nil {
+			Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("encode pdata json: %w", err)}.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(buf)
+	}
+}
+
+// handlePutPdata replaces pdata.
+func (h *Handler) handlePutPdata(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	keepLock := r.URL.Query().Get("keep_lock") == "1"
+
+	token := r.URL.Query().Get("lock")
+	if token == "" {
+		Error{Code: ErrorCodePdataLocked, Message: "no lock token provided"}.ServeHTTP(w, r)
+		return
+	}
+
+	sess, err := h.requireSession(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if perr := h.checkPlayer(r.Context(), sess); perr == nil {
+		if sess.PlayerUID != uid {
+			Error{Code: ErrorCodePermissionDenied, Message: "not authenticated as the player"}.ServeHTTP(w, r)
+			return
+		}
+	} else if serr := h.checkServer(r.Context(), sess); serr != nil {
+		if sess.PlayerUID != 0 {
+			respondError(w, r, perr)
+		} else {
+			respondError(w, r, serr)
+		}
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" && ct != "application/octet-stream" {
+		Error{Code: ErrorCodeBadRequest, Message: "unsupported content type " + strconv.Quote(ct)}.ServeHTTP(w, r)
+		return
+	}
+
+	var b bytes.Buffer
+	if n, err := b.ReadFrom(io.LimitReader(r.Body, maxPdataSize+1)); err != nil {
+		Error{Code: ErrorCodeBadRequest, Message: "failed to read body", Cause: err}.ServeHTTP(w, r)
+		return
+	} else if n > maxPdataSize {
+		Error{Code: ErrorCodeBadRequest, Message: "pdata too large"}.ServeHTTP(w, r)
+		return
+	}
+	buf := b.Bytes()
+
+	if err := h.validatePdata(buf); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	unlock := h.lockUID(uid)
+	defer unlock()
+
+	if ok, err := h.checkPdataLock(r.Context(), uid, token); err != nil {
+		respondError(w, r, err)
+		return
+	} else if !ok {
+		Error{Code: ErrorCodePdataLocked}.ServeHTTP(w, r)
+		return
+	}
+
+	if _, err := h.cfg.PdataStorage.SetPdata(uid, buf); err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("set pdata: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	if !keepLock {
+		if _, err := h.unlockPdataLocked(r.Context(), uid, token); err != nil {
+			respondError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", pdataETag(sha256.Sum256(buf), "raw"))
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"locked": keepLock,
+	})
+}
+
+// validatePdata checks if buf is valid pdata for the current version.
+func (h *Handler) validatePdata(buf []byte) error {
+	var pd pdata.Pdata
+	if err := pd.UnmarshalBinary(buf); err != nil {
+		switch {
+		case errors.Is(err, pdata.ErrUnsupportedVersion):
+			return Error{Code: ErrorCodeBadRequest, Message: "unsupported pdata version (expected " + strconv.Itoa(int(pdata.Version)) + ")", Field: "initializedVersion", Cause: err}
+		case errors.Is(err, pdata.ErrInvalidSize):
+			return Error{Code: ErrorCodeBadRequest, Message: "invalid pdata size", Cause: err}
+		default:
+			return Error{Code: ErrorCodeBadRequest, Message: "invalid pdata", Cause: err}
+		}
+	}
+	if pd.InitializedVersion != pdata.Version {
+		return Error{Code: ErrorCodeBadRequest, Message: "unsupported pdata version (expected " + strconv.Itoa(int(pdata.Version)) + ")", Field: "initializedVersion"}
+	}
+	if h.cfg.RejectInvalidPdataEnums {
+		if err := pd.ValidateEnums(); err != nil {
+			var ferr *pdata.FieldError
+			if errors.As(err, &ferr) {
+				return Error{Code: ErrorCodeBadRequest, Message: "invalid enum value", Field: ferr.Path, Cause: err}
+			}
+			return Error{Code: ErrorCodeBadRequest, Message: "invalid pdata", Cause: err}
+		}
+	}
+	return nil
+}
+
+// handleDeletePdata resets pdata.
+func (h *Handler) handleDeletePdata(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	sess, err := h.requirePlayer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if sess.PlayerUID != uid {
+		Error{Code: ErrorCodePermissionDenied, Message: "not authenticated as the player"}.ServeHTTP(w, r)
+		return
+	}
+
+	unlock := h.lockUID(uid)
+	defer unlock()
+
+	if _, err := h.cfg.PdataStorage.SetPdata(uid, pdata.DefaultPdata); err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("set pdata: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+
+	if _, err := h.unlockPdataLocked(r.Context(), uid, ""); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", pdataETag(defaultPdataHash, "raw"))
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"locked": false,
+	})
+}
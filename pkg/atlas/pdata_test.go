@@ -0,0 +1,84 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/r2northstar/atlas/v2/pkg/pdata"
+)
+
+// getPdata gets the raw pdata for the player, returning the status code, ETag,
+// and body.
+func (c *testClient) getPdata(t *testing.T, etag string) (int, string, []byte) {
+	t.Helper()
+	req, err := http.NewRequest("GET", c.srv.URL+"/pdata/1", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("get pdata: %v", err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("get pdata: %v", err)
+	}
+	return resp.StatusCode, resp.Header.Get("ETag"), buf
+}
+
+func TestPdata(t *testing.T) {
+	_, srv := newTestHandler(t, Config{})
+	c := newTestPlayer(t, srv, 1)
+
+	modified := bytes.Clone(pdata.DefaultPdata)
+	modified[len(modified)-1] ^= 1
+
+	status, defaultETag, buf := c.getPdata(t, "")
+	if status != http.StatusOK || !bytes.Equal(buf, pdata.DefaultPdata) {
+		t.Fatalf("expected default pdata, got status %d", status)
+	}
+	if status, _, _ := c.getPdata(t, defaultETag); status != http.StatusNotModified {
+		t.Errorf("expected not modified for a matching etag, got status %d", status)
+	}
+
+	if _, obj := c.do(t, context.Background(), "PUT", "/pdata/1", modified); errorCode(obj) != ErrorCodePdataLocked {
+		t.Errorf("expected %s without a lock, got %v", ErrorCodePdataLocked, obj)
+	}
+
+	lock := c.mustLock(t, "")
+	if status, obj := c.do(t, context.Background(), "PUT", "/pdata/1?keep_lock=1&lock="+lock, modified); status != http.StatusOK || obj["locked"] != true {
+		t.Fatalf("put pdata: status %d: %v", status, obj)
+	}
+	status, etag, buf := c.getPdata(t, defaultETag)
+	if status != http.StatusOK || !bytes.Equal(buf, modified) || etag == defaultETag {
+		t.Errorf("expected modified pdata with a new etag, got status %d", status)
+	}
+
+	if status, obj := c.do(t, context.Background(), "PUT", "/pdata/1?lock="+lock, modified); status != http.StatusOK || obj["locked"] != false {
+		t.Fatalf("put pdata: status %d: %v", status, obj)
+	}
+	if _, obj := c.do(t, context.Background(), "PUT", "/pdata/1?lock="+lock, modified); errorCode(obj) != ErrorCodePdataLocked {
+		t.Errorf("expected %s after the lock was released, got %v", ErrorCodePdataLocked, obj)
+	}
+
+	other := newTestPlayer(t, srv, 2)
+	if _, obj := other.do(t, context.Background(), "DELETE", "/pdata/1", nil); errorCode(obj) != ErrorCodePermissionDenied {
+		t.Errorf("expected %s for another player, got %v", ErrorCodePermissionDenied, obj)
+	}
+
+	if status, obj := c.do(t, context.Background(), "DELETE", "/pdata/1", nil); status != http.StatusOK {
+		t.Fatalf("delete pdata: status %d: %v", status, obj)
+	}
+	if _, _, buf := c.getPdata(t, ""); !bytes.Equal(buf, pdata.DefaultPdata) {
+		t.Errorf("expected default pdata after delete")
+	}
+}
@@ -0,0 +1,357 @@
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/db/sessiondb"
+)
+
+const (
+	// defaultPdataLockTimeout is how long to wait for the current pdata lock
+	// holder to release it if a timeout isn't specified.
+	defaultPdataLockTimeout = 5 * time.Second
+
+	// maxPdataLockTimeout is the maximum time to wait for the current pdata
+	// lock holder to release it.
+	maxPdataLockTimeout = 30 * time.Second
+)
+
+// pdataMutex serializes pdata lock checks and pdata writes for a single uid.
+type pdataMutex struct {
+	sync.Mutex
+	refs int // protected by Handler.lockMu
+}
+
+// lockUID locks the pdata mutex for uid, returning a function to unlock it. It
+// must be held while checking or changing the pdata lock or the pdata for uid.
+// Other uids are not affected, so it may be held during database operations.
+func (h *Handler) lockUID(uid uint64) (unlock func()) {
+	h.lockMu.Lock()
+	m, ok := h.lockUIDs[uid]
+	if !ok {
+		m = new(pdataMutex)
+		h.lockUIDs[uid] = m
+	}
+	m.refs++
+	h.lockMu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		h.lockMu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(h.lockUIDs, uid)
+		}
+		h.lockMu.Unlock()
+	}
+}
+
+// lockPdata acquires the pdata write lock for uid, waiting up to timeout for
+// the current holder to release it before taking it over. If current is the
+// current lock token, a new lock is returned immediately. The timeout applies
+// to the whole call, even if the lock changes hands while waiting.
+func (h *Handler) lockPdata(ctx context.Context, uid uint64, current, desc string, timeout time.Duration) (sessiondb.PdataLock, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var expired bool // whether the current holder can be taken over
+	for {
+		unlock := h.lockUID(uid)
+		lock, exists, err := h.cfg.SessionStorage.GetPdataLock(ctx, uid)
+		if err != nil {
+			unlock()
+			return lock, fmt.Errorf("get pdata lock: %w", err)
+		}
+		if !exists || (current != "" && lock.Token == current) || expired {
+			lock, err := h.setPdataLockLocked(ctx, uid, desc) // take it over if held
+			unlock()
+			return lock, err
+		}
+		c := h.addLockWaiter(uid)
+		unlock()
+
+		// checked after adding the waiter so it can't be missed by Shutdown
+		if h.shutdown.Load() {
+			h.removeLockWaiter(uid, c)
+			return sessiondb.PdataLock{}, errShuttingDown
+		}
+
+		select {
+		case <-c:
+			continue // released, so try again
+		case <-deadline.C:
+			h.removeLockWaiter(uid, c)
+			expired = true
+		case <-ctx.Done():
+			h.removeLockWaiter(uid, c)
+			return sessiondb.PdataLock{}, ctx.Err()
+		}
+	}
+}
+
+// unlockPdata releases the pdata write lock for uid, waking any waiters. If
+// token is not empty, the lock is only released if it matches. It returns
+// whether the lock was released.
+func (h *Handler) unlockPdata(ctx context.Context, uid uint64, token string) (bool, error) {
+	unlock := h.lockUID(uid)
+	defer unlock()
+
+	return h.unlockPdataLocked(ctx, uid, token)
+}
+
+// unlockPdataLocked is like unlockPdata, but uid must already be locked with
+// lockUID.
+func (h *Handler) unlockPdataLocked(ctx context.Context, uid uint64, token string) (bool, error) {
+	ok, err := h.cfg.SessionStorage.ClearPdataLock(ctx, uid, token)
+	if err != nil {
+		return false, fmt.Errorf("clear pdata lock: %w", err)
+	}
+	if ok {
+		h.wakeLockWaiters(uid)
+	}
+	return ok, nil
+}
+
+// checkPdataLock checks whether token is the current pdata write lock token
+// for uid.
+func (h *Handler) checkPdataLock(ctx context.Context, uid uint64, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	lock, exists, err := h.cfg.SessionStorage.GetPdataLock(ctx, uid)
+	if err != nil {
+		return false, fmt.Errorf("get pdata lock: %w", err)
+	}
+	return exists && lock.Token == token, nil
+}
+
+// transferPdataLock replaces the pdata write lock for uid with a new one if
+// current is the current lock token. It returns false if current is not the
+// current lock token.
+func (h *Handler) transferPdataLock(ctx context.Context, uid uint64, current, desc string) (sessiondb.PdataLock, bool, error) {
+	unlock := h.lockUID(uid)
+	defer unlock()
+
+	if ok, err := h.checkPdataLock(ctx, uid, current); err != nil || !ok {
+		return sessiondb.PdataLock{}, false, err
+	}
+	lock, err := h.setPdataLockLocked(ctx, uid, desc)
+	if err != nil {
+		return lock, false, err
+	}
+	return lock, true, nil
+}
+
+// setPdataLockLocked replaces the pdata write lock for uid with a new one. The
+// uid must already be locked with lockUID.
+func (h *Handler) setPdataLockLocked(ctx context.Context, uid uint64, desc string) (sessiondb.PdataLock, error) {
+	token, err := newToken()
+	if err != nil {
+		return sessiondb.PdataLock{}, fmt.Errorf("generate pdata lock token: %w", err)
+	}
+	lock, err := h.cfg.SessionStorage.SetPdataLock(ctx, uid, token, desc)
+	if err != nil {
+		return lock, fmt.Errorf("set pdata lock: %w", err)
+	}
+	return lock, nil
+}
+
+// addLockWaiter returns a channel which is closed when the pdata write lock
+// for uid is released.
+func (h *Handler) addLockWaiter(uid uint64) chan struct{} {
+	h.lockMu.Lock()
+	defer h.lockMu.Unlock()
+
+	c := make(chan struct{})
+	if h.lockWait[uid] == nil {
+		h.lockWait[uid] = make(map[chan struct{}]struct{})
+	}
+	h.lockWait[uid][c] = struct{}{}
+	return c
+}
+
+func (h *Handler) removeLockWaiter(uid uint64, c chan struct{}) {
+	h.lockMu.Lock()
+	defer h.lockMu.Unlock()
+
+	delete(h.lockWait[uid], c)
+	if len(h.lockWait[uid]) == 0 {
+		delete(h.lockWait, uid)
+	}
+}
+
+// wakeLockWaiters wakes everything waiting for the pdata write lock for uid.
+func (h *Handler) wakeLockWaiters(uid uint64) {
+	h.lockMu.Lock()
+	defer h.lockMu.Unlock()
+
+	for c := range h.lockWait[uid] {
+		close(c)
+	}
+	delete(h.lockWait, uid)
+}
+
+// wakeAllLockWaiters wakes everything waiting for any pdata write lock.
+func (h *Handler) wakeAllLockWaiters() {
+	h.lockMu.Lock()
+	defer h.lockMu.Unlock()
+
+	for uid, cs := range h.lockWait {
+		for c := range cs {
+			close(c)
+		}
+		delete(h.lockWait, uid)
+	}
+}
+
+// sessionDesc returns a human-readable description of the session for pdata
+// lock descriptions.
+func (h *Handler) sessionDesc(ctx context.Context, sess sessiondb.Session) string {
+	if h.checkPlayer(ctx, sess) == nil {
+		return "player " + strconv.FormatUint(sess.PlayerUID, 10) + " (session " + strconv.FormatInt(sess.ID, 10) + ")"
+	}
+	if h.checkServer(ctx, sess) == nil {
+		return "server " + sess.ServerAddr.String() + " (session " + strconv.FormatInt(sess.ID, 10) + ")"
+	}
+	return "session " + strconv.FormatInt(sess.ID, 10)
+}
+
+// handleGetPdataLock gets information about the current pdata lock holder.
+func (h *Handler) handleGetPdataLock(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	sess, err := h.requirePlayer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if sess.PlayerUID != uid {
+		Error{Code: ErrorCodePermissionDenied, Message: "not authenticated as the player"}.ServeHTTP(w, r)
+		return
+	}
+
+	lock, exists, err := h.cfg.SessionStorage.GetPdataLock(r.Context(), uid)
+	if err != nil {
+		Error{Code: ErrorCodeInternalError, Cause: fmt.Errorf("get pdata lock: %w", err)}.ServeHTTP(w, r)
+		return
+	}
+	if !exists {
+		respondJSON(w, r, http.StatusOK, map[string]any{
+			"locked": false,
+		})
+		return
+	}
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"locked":  true,
+		"desc":    lock.Desc,
+		"created": lock.Created.Unix(),
+	})
+}
+
+// handlePostPdataLock acquires the pdata lock.
+func (h *Handler) handlePostPdataLock(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	timeout := defaultPdataLockTimeout
+	if x := r.URL.Query().Get("timeout"); x != "" {
+		if v, err := time.ParseDuration(x); err != nil || v < 0 {
+			Error{Code: ErrorCodeBadRequest, Message: "invalid timeout"}.ServeHTTP(w, r)
+			return
+		} else {
+			timeout = min(v, maxPdataLockTimeout)
+		}
+	}
+
+	sess, err := h.requireSession(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	current := r.URL.Query().Get("lock")
+	if current != "" {
+		if ok, err := h.checkPdataLock(r.Context(), uid, current); err != nil {
+			respondError(w, r, err)
+			return
+		} else if !ok {
+			Error{Code: ErrorCodePdataLocked}.ServeHTTP(w, r)
+			return
+		}
+	} else {
+		if err := h.checkPlayer(r.Context(), sess); err != nil {
+			respondError(w, r, err)
+			return
+		}
+		if sess.PlayerUID != uid {
+			Error{Code: ErrorCodePermissionDenied, Message: "not authenticated as the player"}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	lock, err := h.lockPdata(r.Context(), uid, current, h.sessionDesc(r.Context(), sess), timeout)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // client went away
+		}
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"token": lock.Token,
+	})
+}
+
+// handleDeletePdataLock releases the pdata lock.
+func (h *Handler) handleDeletePdataLock(w http.ResponseWriter, r *http.Request) {
+	uid, err := pathUID(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	sess, err := h.requireSession(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	token := r.URL.Query().Get("lock")
+	if token == "" {
+		if err := h.checkPlayer(r.Context(), sess); err != nil {
+			respondError(w, r, err)
+			return
+		}
+		if sess.PlayerUID != uid {
+			Error{Code: ErrorCodePermissionDenied, Message: "not authenticated as the player"}.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	ok, err := h.unlockPdata(r.Context(), uid, token)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if !ok && token != "" {
+		Error{Code: ErrorCodePdataLocked}.ServeHTTP(w, r)
+		return
+	}
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"locked": false,
+	})
+}
@@ -0,0 +1,250 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// lockWaiters returns the number of requests waiting for the pdata lock for
+// uid.
+func (h *Handler) lockWaiters(uid uint64) int {
+	h.lockMu.Lock()
+	defer h.lockMu.Unlock()
+	return len(h.lockWait[uid])
+}
+
+// lockResult is the result of a pdata lock request.
+type lockResult struct {
+	Token   string
+	Code    string
+	Elapsed time.Duration
+}
+
+// lock requests the pdata lock for the player in the background.
+func (c *testClient) lock(t *testing.T, ctx context.Context, query string) <-chan lockResult {
+	ch := make(chan lockResult, 1)
+	go func() {
+		start := time.Now()
+		_, obj := c.do(t, ctx, "POST", "/pdata/1/lock?"+query, nil)
+		token, _ := obj["token"].(string)
+		ch <- lockResult{token, errorCode(obj), time.Since(start)}
+	}()
+	return ch
+}
+
+// mustLock requests the pdata lock for the player, failing if it isn't
+// acquired.
+func (c *testClient) mustLock(t *testing.T, query string) string {
+	t.Helper()
+	res := <-c.lock(t, context.Background(), query)
+	if res.Token == "" {
+		t.Fatalf("lock: got error %q", res.Code)
+	}
+	return res.Token
+}
+
+// unlock releases the pdata lock for the player using token.
+func (c *testClient) unlock(t *testing.T, token string) {
+	t.Helper()
+	if status, obj := c.do(t, context.Background(), "DELETE", "/pdata/1/lock?lock="+token, nil); status != http.StatusOK {
+		t.Fatalf("unlock: status %d: %v", status, obj)
+	}
+}
+
+// mustCheckLock checks whether token is the current pdata lock token for uid.
+func (h *Handler) mustCheckLock(t *testing.T, uid uint64, token string) bool {
+	t.Helper()
+	ok, err := h.checkPdataLock(context.Background(), uid, token)
+	if err != nil {
+		t.Fatalf("check pdata lock: %v", err)
+	}
+	return ok
+}
+
+func TestPdataLock(t *testing.T) {
+	h, srv := newTestHandler(t, Config{})
+	c := newTestPlayer(t, srv, 1)
+
+	t.Run("Info", func(t *testing.T) {
+		_, obj := c.do(t, context.Background(), "GET", "/pdata/1/lock", nil)
+		if obj["locked"] != false {
+			t.Errorf("expected unlocked, got %v", obj)
+		}
+		token := c.mustLock(t, "")
+		_, obj = c.do(t, context.Background(), "GET", "/pdata/1/lock", nil)
+		if obj["locked"] != true || obj["desc"] == "" {
+			t.Errorf("expected locked with a description, got %v", obj)
+		}
+		c.unlock(t, token)
+	})
+
+	t.Run("Renew", func(t *testing.T) {
+		a := c.mustLock(t, "")
+		res := <-c.lock(t, context.Background(), "timeout=10s&lock="+a)
+		if res.Token == "" || res.Token == a {
+			t.Fatalf("expected a new token, got %+v", res)
+		}
+		if res.Elapsed > time.Second {
+			t.Errorf("expected renewal to be immediate, took %s", res.Elapsed)
+		}
+		if h.mustCheckLock(t, 1, a) {
+			t.Errorf("old token is still valid")
+		}
+		if !h.mustCheckLock(t, 1, res.Token) {
+			t.Errorf("new token is not valid")
+		}
+		c.unlock(t, res.Token)
+	})
+
+	t.Run("WakeOnRelease", func(t *testing.T) {
+		a := c.mustLock(t, "")
+		ch := c.lock(t, context.Background(), "timeout=10s")
+		waitFor(t, "waiter", func() bool { return h.lockWaiters(1) == 1 })
+
+		c.unlock(t, a)
+		res := <-ch
+		if res.Token == "" {
+			t.Fatalf("expected lock, got error %q", res.Code)
+		}
+		if res.Elapsed > 5*time.Second {
+			t.Errorf("expected waiter to be woken on release, took %s", res.Elapsed)
+		}
+		if h.mustCheckLock(t, 1, a) || !h.mustCheckLock(t, 1, res.Token) {
+			t.Errorf("expected only the new token to be valid")
+		}
+		c.unlock(t, res.Token)
+	})
+
+	t.Run("TakeoverAfterTimeout", func(t *testing.T) {
+		a := c.mustLock(t, "")
+		res := <-c.lock(t, context.Background(), "timeout=200ms")
+		if res.Token == "" {
+			t.Fatalf("expected lock, got error %q", res.Code)
+		}
+		if res.Elapsed < 200*time.Millisecond {
+			t.Errorf("expected to wait for the timeout, took %s", res.Elapsed)
+		}
+		if h.mustCheckLock(t, 1, a) || !h.mustCheckLock(t, 1, res.Token) {
+			t.Errorf("expected only the new token to be valid")
+		}
+		if _, obj := c.do(t, context.Background(), "DELETE", "/pdata/1/lock?lock="+a, nil); errorCode(obj) != ErrorCodePdataLocked {
+			t.Errorf("expected %s when releasing a lock which was taken over, got %v", ErrorCodePdataLocked, obj)
+		}
+		c.unlock(t, res.Token)
+	})
+
+	t.Run("TimeoutIsAbsolute", func(t *testing.T) {
+		c.mustLock(t, "")
+		ch1 := c.lock(t, context.Background(), "timeout=300ms")
+		waitFor(t, "first waiter", func() bool { return h.lockWaiters(1) == 1 })
+		ch2 := c.lock(t, context.Background(), "timeout=400ms")
+		waitFor(t, "second waiter", func() bool { return h.lockWaiters(1) == 2 })
+
+		res1 := <-ch1
+		if res1.Token == "" {
+			t.Fatalf("expected first waiter to take over, got error %q", res1.Code)
+		}
+		res2 := <-ch2
+		if res2.Token == "" {
+			t.Fatalf("expected second waiter to take over, got error %q", res2.Code)
+		}
+		// the second waiter shouldn't start waiting again when the first one
+		// takes over
+		if res2.Elapsed < 400*time.Millisecond || res2.Elapsed > 400*time.Millisecond+250*time.Millisecond {
+			t.Errorf("expected second waiter to take over after its timeout, took %s", res2.Elapsed)
+		}
+		if h.mustCheckLock(t, 1, res1.Token) || !h.mustCheckLock(t, 1, res2.Token) {
+			t.Errorf("expected only the second waiter's token to be valid")
+		}
+		c.unlock(t, res2.Token)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		a := c.mustLock(t, "")
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := c.lock(t, ctx, "timeout=10s")
+		waitFor(t, "waiter", func() bool { return h.lockWaiters(1) == 1 })
+
+		cancel()
+		if res := <-ch; res.Token != "" {
+			t.Errorf("expected no lock after cancelling, got %+v", res)
+		}
+		waitFor(t, "waiter removal", func() bool { return h.lockWaiters(1) == 0 })
+		if !h.mustCheckLock(t, 1, a) {
+			t.Errorf("expected the lock to still be held")
+		}
+		c.unlock(t, a)
+	})
+
+	t.Run("RequireSession", func(t *testing.T) {
+		a := c.mustLock(t, "")
+		anon := &testClient{srv: srv}
+		for _, method := range []string{"POST", "DELETE"} {
+			if _, obj := anon.do(t, context.Background(), method, "/pdata/1/lock?lock="+a, nil); errorCode(obj) != ErrorCodeAuthMissing {
+				t.Errorf("%s: expected %s, got %v", method, ErrorCodeAuthMissing, obj)
+			}
+		}
+		if !h.mustCheckLock(t, 1, a) {
+			t.Errorf("expected the lock to still be held")
+		}
+
+		// but any session can use the token
+		other := newTestSession(t, srv)
+		if status, obj := other.do(t, context.Background(), "DELETE", "/pdata/1/lock?lock="+a, nil); status != http.StatusOK {
+			t.Errorf("unlock: status %d: %v", status, obj)
+		}
+	})
+
+	t.Run("Sweep", func(t *testing.T) {
+		h, srv := newTestHandler(t, Config{PdataLockTTL: time.Millisecond})
+		c := newTestPlayer(t, srv, 1)
+
+		a := c.mustLock(t, "")
+		ch := c.lock(t, context.Background(), "timeout=10s")
+		waitFor(t, "waiter", func() bool { return h.lockWaiters(1) == 1 })
+
+		// since times are stored with second precision, wait until the second
+		// after the lock was created
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second + 10*time.Millisecond)))
+		h.sweep(context.Background())
+
+		res := <-ch
+		if res.Token == "" {
+			t.Fatalf("expected lock, got error %q", res.Code)
+		}
+		if res.Elapsed > 5*time.Second {
+			t.Errorf("expected waiter to be woken by the sweep, took %s", res.Elapsed)
+		}
+		if h.mustCheckLock(t, 1, a) {
+			t.Errorf("expected the expired lock to be removed")
+		}
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		h, srv := newTestHandler(t, Config{})
+		c := newTestPlayer(t, srv, 1)
+
+		a := c.mustLock(t, "")
+		ch := c.lock(t, context.Background(), "timeout=10s")
+		waitFor(t, "waiter", func() bool { return h.lockWaiters(1) == 1 })
+
+		h.Shutdown()
+		if res := <-ch; res.Code != string(ErrorCodeBackendServiceUnavailable) || res.Elapsed > 5*time.Second {
+			t.Errorf("expected waiter to fail promptly with %s, got %+v", ErrorCodeBackendServiceUnavailable, res)
+		}
+		if res := <-c.lock(t, context.Background(), "timeout=10s"); res.Code != string(ErrorCodeBackendServiceUnavailable) {
+			t.Errorf("expected new waiters to fail with %s, got %+v", ErrorCodeBackendServiceUnavailable, res)
+		}
+		if h.lockWaiters(1) != 0 {
+			t.Errorf("expected no waiters after shutdown")
+		}
+
+		// the lock is kept for after a restart, and can still be used
+		if !h.mustCheckLock(t, 1, a) {
+			t.Errorf("expected the lock to still be held")
+		}
+		c.unlock(t, a)
+	})
+}
@@ -0,0 +1,96 @@
+package atlas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/r2northstar/atlas/v2/pkg/stryder"
+)
+
+var (
+	ErrPlayerAuthUnsupported = errors.New("unsupported player authentication method")
+	ErrPlayerAuthFailed      = errors.New("player authentication failed")
+	ErrPlayerAuthUnavailable = errors.New("player authentication backend unavailable")
+)
+
+// PlayerAuthenticator verifies player identities.
+type PlayerAuthenticator interface {
+	// AuthenticatePlayer verifies token using method, returning the verified
+	// uid and username. The uid claimed by the client is provided since some
+	// methods require it, but the returned uid is the one which will be used.
+	// If the username is empty, the last known username is kept.
+	//
+	// Errors should wrap ErrPlayerAuthUnsupported if the method is not
+	// supported, ErrPlayerAuthFailed if the token is invalid, or
+	// ErrPlayerAuthUnavailable if the backend could not be reached.
+	AuthenticatePlayer(ctx context.Context, method, token string, claimed uint64) (uid uint64, username string, err error)
+}
+
+// OriginPlayerAuthenticator authenticates players with the origin method using
+// Origin tokens verified by Stryder.
+type OriginPlayerAuthenticator struct {
+	// Client is used to make requests to Stryder. If nil,
+	// [net/http.DefaultClient] is used.
+	Client *http.Client
+
+	// Username, if provided, looks up the username for a verified uid. Stryder
+	// itself doesn't return usernames, so if this is nil, the username is
+	// always empty and the last known username (if any) is kept.
+	Username func(ctx context.Context, uid uint64) (string, error)
+}
+
+func (a *OriginPlayerAuthenticator) AuthenticatePlayer(ctx context.Context, method, token string, claimed uint64) (uint64, string, error) {
+	if method != "origin" {
+		return 0, "", fmt.Errorf("%w %q", ErrPlayerAuthUnsupported, method)
+	}
+	if err := stryder.NucleusAuth(ctx, a.Client, token, claimed); err != nil {
+		switch {
+		case errors.Is(err, stryder.ErrInvalidToken), errors.Is(err, stryder.ErrMultiplayerNotAllowed):
+			return 0, "", fmt.Errorf("%w: %v", ErrPlayerAuthFailed, err)
+		case errors.Is(err, stryder.ErrUnavailable):
+			return 0, "", fmt.Errorf("%w: %v", ErrPlayerAuthUnavailable, err)
+		default:
+			return 0, "", err
+		}
+	}
+	var username string
+	if a.Username != nil {
+		if u, err := a.Username(ctx, claimed); err != nil {
+			return 0, "", fmt.Errorf("get username: %w", err)
+		} else {
+			username = u
+		}
+	}
+	return claimed, username, nil
+}
+
+// FakePlayerAuthenticator authenticates players without verifying anything.
+// It must only be used for local testing.
+type FakePlayerAuthenticator struct {
+	// Methods, if provided, limits the accepted methods. Otherwise, all methods
+	// are accepted.
+	Methods []string
+}
+
+// AuthenticatePlayer accepts any non-empty token as the username for the
+// claimed uid.
+func (a *FakePlayerAuthenticator) AuthenticatePlayer(ctx context.Context, method, token string, claimed uint64) (uint64, string, error) {
+	if a.Methods != nil {
+		var ok bool
+		for _, m := range a.Methods {
+			if m == method {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return 0, "", fmt.Errorf("%w %q", ErrPlayerAuthUnsupported, method)
+		}
+	}
+	if token == "" {
+		return 0, "", fmt.Errorf("%w: empty token", ErrPlayerAuthFailed)
+	}
+	return claimed, token, nil
+}
@@ -0,0 +1,80 @@
+package atlas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// stubTransport sends all requests to a test server.
+type stubTransport struct {
+	URL string
+}
+
+func (t stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newStubStryder returns a client which sends Stryder requests to a test
+// server responding with status and body.
+func newStubStryder(t *testing.T, status int, body string) *http.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return &http.Client{Transport: stubTransport{srv.URL}}
+}
+
+func TestOriginPlayerAuthenticator(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Method   string
+		Status   int
+		Body     string
+		Username func(context.Context, uint64) (string, error)
+		Err      error
+	}{
+		{"OK", "origin", 200, `{"success":true,"status":"200","hasOnlineAccess":"1"}`, nil, nil},
+		{"Username", "origin", 200, `{"success":true,"status":"200","hasOnlineAccess":"1"}`, func(context.Context, uint64) (string, error) { return "test", nil }, nil},
+		{"UnsupportedMethod", "fake", 200, `{"success":true,"status":"200","hasOnlineAccess":"1"}`, nil, ErrPlayerAuthUnsupported},
+		{"InvalidToken", "origin", 200, `{"success":false,"status":"401","error":"bad token"}`, nil, ErrPlayerAuthFailed},
+		{"NoOnlineAccess", "origin", 200, `{"success":true,"status":"200","hasOnlineAccess":"0"}`, nil, ErrPlayerAuthFailed},
+		{"Unavailable", "origin", 503, `unavailable`, nil, ErrPlayerAuthUnavailable},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			a := &OriginPlayerAuthenticator{
+				Client:   newStubStryder(t, tc.Status, tc.Body),
+				Username: tc.Username,
+			}
+			uid, username, err := a.AuthenticatePlayer(context.Background(), tc.Method, "token", 1)
+			if tc.Err != nil {
+				if !errors.Is(err, tc.Err) {
+					t.Errorf("expected error %q, got %v", tc.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if uid != 1 {
+				t.Errorf("expected uid 1, got %d", uid)
+			}
+			if tc.Username == nil && username != "" {
+				t.Errorf("expected no username without a username source, got %q", username)
+			}
+			if tc.Username != nil && username != "test" {
+				t.Errorf("expected username from the username source, got %q", username)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle rate limit buckets are removed.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is a token bucket rate limit.
+type RateLimit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // maximum tokens; if zero, there is no limit
+}
+
+// RateLimits are the rate limits for a class of requests.
+type RateLimits struct {
+	IP      RateLimit // per client ip (or ipv6 /64)
+	Session RateLimit // per valid session
+}
+
+// DefaultRateLimits are the default rate limits for each request class.
+var DefaultRateLimits = map[string]RateLimits{
+	"auth": {
+		IP:      RateLimit{Rate: 1, Burst: 10},
+		Session: RateLimit{Rate: 0.2, Burst: 5},
+	},
+	"pdata_read": {
+		IP:      RateLimit{Rate: 5, Burst: 30},
+		Session: RateLimit{Rate: 1, Burst: 10},
+	},
+	"pdata_write": {
+		IP:      RateLimit{Rate: 5, Burst: 30},
+		Session: RateLimit{Rate: 1, Burst: 10},
+	},
+	"server_write": {
+		IP:      RateLimit{Rate: 5, Burst: 30},
+		Session: RateLimit{Rate: 1, Burst: 10},
+	},
+	"server_list": {
+		IP: RateLimit{Rate: 2, Burst: 20},
+	},
+	"connect": {
+		IP:      RateLimit{Rate: 1, Burst: 10},
+		Session: RateLimit{Rate: 0.5, Burst: 5},
+	},
+	"other": {
+		IP: RateLimit{Rate: 10, Burst: 50},
+	},
+}
+
+// rateLimitClasses maps mux patterns to rate limit classes. Requests not
+// matching any of these are in the "other" class.
+var rateLimitClasses = map[string]string{
+	"POST /auth":                        "auth",
+	"POST /auth/player":                 "auth",
+	"POST /auth/server":                 "auth",
+	"GET /pdata/{uid}":                  "pdata_read",
+	"GET /pdata/{uid}/lock":             "pdata_read",
+	"PUT /pdata/{uid}":                  "pdata_write",
+	"DELETE /pdata/{uid}":               "pdata_write",
+	"POST /pdata/{uid}/lock":            "pdata_write",
+	"DELETE /pdata/{uid}/lock":          "pdata_write",
+	"POST /server":                      "server_write",
+	"PATCH /server/{id}":                "server_write",
+	"DELETE /server/{id}":               "server_write",
+	"POST /server/{id}/connect/{token}": "server_write",
+	"GET /server":                       "server_list",
+	"GET /server/{id}":                  "server_list",
+	"GET /mainmenupromos":               "server_list",
+	"POST /server/{id}/connect":         "connect",
+}
+
+// tokenBucket is the state of a token bucket.
+type tokenBucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// refill adds tokens to b for the time elapsed since it was last updated.
+func (l RateLimit) refill(b *tokenBucket, now time.Time) {
+	if d := now.Sub(b.Last); d > 0 {
+		b.Tokens = math.Min(float64(l.Burst), b.Tokens+d.Seconds()*l.Rate)
+		b.Last = now
+	}
+}
+
+// wait returns the time until b has a token.
+func (l RateLimit) wait(b *tokenBucket) time.Duration {
+	if b.Tokens >= 1 {
+		return 0
+	}
+	if l.Rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - b.Tokens) / l.Rate * float64(time.Second))
+}
+
+// rateLimiter limits requests for a single class.
+type rateLimiter struct {
+	limits RateLimits
+
+	mu      sync.Mutex
+	ip      map[netip.Prefix]*tokenBucket
+	session map[int64]*tokenBucket // [session id]
+
+	metrics struct {
+		allowed         atomic.Uint64
+		limited_ip      atomic.Uint64
+		limited_session atomic.Uint64
+	}
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	return &rateLimiter{
+		limits:  limits,
+		ip:      make(map[netip.Prefix]*tokenBucket),
+		session: make(map[int64]*tokenBucket),
+	}
+}
+
+// bucket gets or creates a full bucket in m.
+func bucket[K comparable](m map[K]*tokenBucket, k K, l RateLimit, now time.Time) *tokenBucket {
+	b, ok := m[k]
+	if !ok {
+		b = &tokenBucket{Tokens: float64(l.Burst), Last: now}
+		m[k] = b
+	}
+	l.refill(b, now)
+	return b
+}
+
+// allow takes a token from the buckets for the ip and session id, if provided,
+// returning how long to wait if either is empty.
+func (rl *rateLimiter) allow(ip netip.Prefix, session int64, now time.Time) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var bi, bs *tokenBucket
+	if rl.limits.IP.Burst > 0 && ip.IsValid() {
+		bi = bucket(rl.ip, ip, rl.limits.IP, now)
+		if d := rl.limits.IP.wait(bi); d > 0 {
+			rl.metrics.limited_ip.Add(1)
+			return d, false
+		}
+	}
+	if rl.limits.Session.Burst > 0 && session != 0 {
+		bs = bucket(rl.session, session, rl.limits.Session, now)
+		if d := rl.limits.Session.wait(bs); d > 0 {
+			rl.metrics.limited_session.Add(1)
+			return d, false
+		}
+	}
+	if bi != nil {
+		bi.Tokens--
+	}
+	if bs != nil {
+		bs.Tokens--
+	}
+	rl.metrics.allowed.Add(1)
+	return 0, true
+}
+
+// sweep removes buckets which have refilled completely.
+func (rl *rateLimiter) sweep(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for k, b := range rl.ip {
+		if rl.limits.IP.refill(b, now); b.Tokens >= float64(rl.limits.IP.Burst) {
+			delete(rl.ip, k)
+		}
+	}
+	for k, b := range rl.session {
+		if rl.limits.Session.refill(b, now); b.Tokens >= float64(rl.limits.Session.Burst) {
+			delete(rl.session, k)
+		}
+	}
+}
+
+// initRateLimit creates the rate limiters for each class.
+func (h *Handler) initRateLimit() error {
+	if h.cfg.DisableRateLimit {
+		return nil
+	}
+	h.rateLimit = make(map[string]*rateLimiter, len(DefaultRateLimits))
+	for class, limits := range DefaultRateLimits {
+		if x, ok := h.cfg.RateLimits[class]; ok {
+			limits = x
+		}
+		h.rateLimit[class] = newRateLimiter(limits)
+	}
+	for class := range h.cfg.RateLimits {
+		if _, ok := h.rateLimit[class]; !ok {
+			return fmt.Errorf("unknown rate limit class %q", class)
+		}
+	}
+	return nil
+}
+
+// checkRateLimit checks whether r, which matched the mux pattern, is allowed
+// by the rate limits for its class, returning the class and how long until the
+// client can try again.
+func (h *Handler) checkRateLimit(r *http.Request, pattern string) (string, time.Duration, bool) {
+	if h.rateLimit == nil {
+		return "", 0, false
+	}
+
+	class := "other"
+	if c, ok := rateLimitClasses[pattern]; ok {
+		class = c
+	}
+
+	var ip netip.Prefix
+	if a, ok := remoteAddr(r); ok {
+		if a.Is4() {
+			ip = netip.PrefixFrom(a, 32)
+		} else {
+			ip, _ = a.Prefix(64)
+		}
+	}
+
+	rl := h.rateLimit[class]
+
+	var session int64
+	if rl.limits.Session.Burst > 0 {
+		session = h.rateLimitSession(r)
+	}
+
+	d, ok := rl.allow(ip, session, time.Now())
+	return class, d, !ok
+}
+
+// rateLimitSession gets the id of the session to rate limit r by. Missing,
+// unknown, and expired session tokens return zero, so they are only limited by
+// ip (and can't be used to create an unbounded number of buckets).
+func (h *Handler) rateLimitSession(r *http.Request) int64 {
+	token := sessionToken(r)
+	if token == "" {
+		return 0
+	}
+	sess, exists, err := h.cfg.SessionStorage.GetSession(r.Context(), token)
+	if err != nil || !exists {
+		return 0 // if it's an error, the handler will deal with it
+	}
+	if h.cfg.SessionTTL > 0 && time.Since(sess.Used) > h.cfg.SessionTTL {
+		return 0
+	}
+	return sess.ID
+}
+
+// runRateLimitSweeper periodically removes idle rate limit buckets.
+func (h *Handler) runRateLimitSweeper(ctx context.Context) {
+	if h.rateLimit == nil {
+		return
+	}
+
+	t := time.NewTicker(rateLimitSweepInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		for _, rl := range h.rateLimit {
+			rl.sweep(now)
+		}
+	}
+}
+
+func (h *Handler) writeRateLimitMetrics(w io.Writer) {
+	classes := make([]string, 0, len(h.rateLimit))
+	for class := range h.rateLimit {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	for _, class := range classes {
+		rl := h.rateLimit[class]
+		fmt.Fprintln(w, `atlas_ratelimit_requests_count{class="`+class+`",result="allowed"}`, rl.metrics.allowed.Load())
+		fmt.Fprintln(w, `atlas_ratelimit_requests_count{class="`+class+`",result="limited_ip"}`, rl.metrics.limited_ip.Load())
+		fmt.Fprintln(w, `atlas_ratelimit_requests_count{class="`+class+`",result="limited_session"}`, rl.metrics.limited_session.Load())
+	}
+	for _, class := range classes {
+		rl := h.rateLimit[class]
+		rl.mu.Lock()
+		ip, session := len(rl.ip), len(rl.session)
+		rl.mu.Unlock()
+		fmt.Fprintln(w, `atlas_ratelimit_buckets{class="`+class+`",key="ip"}`, ip)
+		fmt.Fprintln(w, `atlas_ratelimit_buckets{class="`+class+`",key="session"}`, session)
+	}
+}
@@ -0,0 +1,129 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(RateLimits{
+		IP:      RateLimit{Rate: 1, Burst: 3},
+		Session: RateLimit{Rate: 0.5, Burst: 2},
+	})
+	now := time.Now()
+	ip := netip.MustParsePrefix("192.0.2.1/32")
+
+	for i := range 3 {
+		if _, ok := rl.allow(ip, 0, now); !ok {
+			t.Fatalf("request %d: expected ip burst to be allowed", i)
+		}
+	}
+	if d, ok := rl.allow(ip, 0, now); ok || d != time.Second {
+		t.Errorf("expected ip to be limited for 1s, got %v %v", ok, d)
+	}
+	if _, ok := rl.allow(ip, 0, now.Add(time.Second)); !ok {
+		t.Errorf("expected ip bucket to be refilled")
+	}
+
+	other := netip.MustParsePrefix("192.0.2.2/32")
+	for i := range 2 {
+		if _, ok := rl.allow(other, 1, now); !ok {
+			t.Fatalf("request %d: expected session burst to be allowed", i)
+		}
+	}
+	if d, ok := rl.allow(other, 1, now); ok || d != 2*time.Second {
+		t.Errorf("expected session to be limited for 2s, got %v %v", ok, d)
+	}
+	if _, ok := rl.allow(other, 2, now); !ok {
+		t.Errorf("expected other sessions not to be limited")
+	}
+
+	// limited requests don't take a token from the other bucket
+	rl.mu.Lock()
+	tokens := rl.ip[other].Tokens
+	rl.mu.Unlock()
+	if tokens != 0 {
+		t.Errorf("expected ip bucket to have 0 tokens, got %v", tokens)
+	}
+
+	rl.sweep(now.Add(time.Hour))
+	rl.mu.Lock()
+	n := len(rl.ip) + len(rl.session)
+	rl.mu.Unlock()
+	if n != 0 {
+		t.Errorf("expected full buckets to be swept, got %d", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h, srv := newTestHandler(t, Config{
+		RateLimits: map[string]RateLimits{
+			"pdata_read": {
+				IP:      RateLimit{Rate: 0.001, Burst: 100},
+				Session: RateLimit{Rate: 0.001, Burst: 2},
+			},
+		},
+	})
+	rl := h.rateLimit["pdata_read"]
+
+	buckets := func() (ip float64, sessions int) {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		for _, b := range rl.ip {
+			ip += b.Tokens
+		}
+		return ip, len(rl.session)
+	}
+
+	t.Run("InvalidSession", func(t *testing.T) {
+		for i := range 5 {
+			c := &testClient{srv: srv, token: "invalid" + strconv.Itoa(i)}
+			if _, obj := c.do(t, context.Background(), "GET", "/pdata/1", nil); errorCode(obj) != ErrorCodeAuthInvalid {
+				t.Errorf("expected %s, got %v", ErrorCodeAuthInvalid, obj)
+			}
+		}
+		ip, sessions := buckets()
+		if sessions != 0 {
+			t.Errorf("expected no session buckets for invalid tokens, got %d", sessions)
+		}
+		if ip < 94.9 || ip > 95.1 {
+			t.Errorf("expected invalid tokens to count towards the ip limit, got %v tokens left", ip)
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 1)
+		for i := range 2 {
+			if status, obj := c.do(t, context.Background(), "GET", "/pdata/1", nil); status != http.StatusOK {
+				t.Fatalf("request %d: status %d: %v", i, status, obj)
+			}
+		}
+		if _, sessions := buckets(); sessions != 1 {
+			t.Errorf("expected 1 session bucket, got %d", sessions)
+		}
+
+		req, err := http.NewRequest("GET", srv.URL+"/pdata/1", nil)
+		if err != nil {
+			t.Fatalf("create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("get pdata: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+			t.Errorf("expected 429 with Retry-After, got status %d", resp.StatusCode)
+		}
+
+		// other sessions from the same ip aren't affected
+		d := newTestPlayer(t, srv, 2)
+		if status, obj := d.do(t, context.Background(), "GET", "/pdata/2", nil); status != http.StatusOK {
+			t.Errorf("expected other session to be allowed, got status %d: %v", status, obj)
+		}
+	})
+}
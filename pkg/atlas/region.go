@@ -0,0 +1,85 @@
+package atlas
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/pg9182/ip2x"
+	"github.com/r2northstar/atlas/v2/pkg/regionmap"
+)
+
+// maxRegionCacheSize is the maximum number of cached region lookups before the
+// cache is cleared.
+const maxRegionCacheSize = 8192
+
+// openIP2Location opens the IP2Location database at name. The returned file
+// must be kept open for the lifetime of the database.
+func openIP2Location(name string) (*ip2x.DB, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := ip2x.New(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("parse ip2location database: %w", err)
+	}
+	return db, f, nil
+}
+
+// getRegion gets the region for ip, returning an empty string if it cannot be
+// determined.
+func (h *Handler) getRegion(ip netip.Addr) string {
+	if h.ip2location == nil {
+		return ""
+	}
+	ip = ip.Unmap().WithZone("")
+
+	h.regionMu.Lock()
+	region, ok := h.regionCache[ip]
+	h.regionMu.Unlock()
+
+	if ok {
+		h.metrics.region_lookup_count.cached.Add(1)
+		return region
+	}
+
+	rec, err := h.ip2location.Lookup(ip)
+	if err != nil {
+		h.metrics.region_lookup_count.error.Add(1)
+		h.cfg.Logger.Warn("failed to look up ip2location record", "ip", ip, "error", err)
+		return "" // don't cache errors
+	}
+
+	region, err = regionmap.GetRegion(ip, rec)
+	switch {
+	case err == nil:
+		h.metrics.region_lookup_count.success.Add(1)
+	case region != "":
+		h.metrics.region_lookup_count.best_effort.Add(1)
+		h.cfg.Logger.Warn("using best-effort region for ip", "ip", ip, "region", region, "error", err)
+	default:
+		h.metrics.region_lookup_count.error.Add(1)
+		h.cfg.Logger.Warn("failed to get region for ip", "ip", ip, "error", err)
+	}
+
+	h.regionMu.Lock()
+	if len(h.regionCache) >= maxRegionCacheSize {
+		clear(h.regionCache)
+	}
+	h.regionCache[ip] = region
+	h.regionMu.Unlock()
+
+	return region
+}
+
+// writeRegionMetrics writes prometheus text metrics for region lookups to w.
+func (h *Handler) writeRegionMetrics(w io.Writer) {
+	promHeader(w, "atlas_region_lookup_count", "counter", "Server region lookups by result.")
+	fmt.Fprintln(w, `atlas_region_lookup_count{result="cached"}`, h.metrics.region_lookup_count.cached.Load())
+	fmt.Fprintln(w, `atlas_region_lookup_count{result="success"}`, h.metrics.region_lookup_count.success.Load())
+	fmt.Fprintln(w, `atlas_region_lookup_count{result="best_effort"}`, h.metrics.region_lookup_count.best_effort.Load())
+	fmt.Fprintln(w, `atlas_region_lookup_count{result="error"}`, h.metrics.region_lookup_count.error.Load())
+}
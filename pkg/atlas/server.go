@@ -1,5 +1,417 @@
 package atlas
 
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// serverExpiryInterval is how often servers which have missed their
+// heartbeats are removed.
+const serverExpiryInterval = 5 * time.Second
+
+// maxServerMetadataSize is the maximum size of a server metadata request body.
+const maxServerMetadataSize = 64 << 10
+
+// server is a registered game server.
+type server struct {
+	ID        string
+	SessionID int64
+	Addr      netip.AddrPort
+	Key       string // session key for connectionless packets
+	Created   time.Time
+	Heartbeat time.Time
+	Region    string
+
+	Name        string
+	Description string
+	Map         string
+	Playlist    string
+	Players     int
+	MaxPlayers  int
+	Password    bool
+	Mods        []serverMod
+}
+
+// serverMod is a mod loaded by a game server.
+type serverMod struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Required bool   `json:"required"`
+}
+
+// serverMetadata is the request body for updating server metadata. Fields
+// which are not set are left as-is.
+type serverMetadata struct {
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Map         *string      `json:"map"`
+	Playlist    *string      `json:"playlist"`
+	Players     *int         `json:"players"`
+	MaxPlayers  *int         `json:"max_players"`
+	Password    *bool        `json:"password"`
+	Mods        *[]serverMod `json:"mods"`
+}
+
 func (h *Handler) initServer() error {
+	h.cfg.Mux.HandleFunc("GET /server", h.handleListServers)
+	h.cfg.Mux.HandleFunc("POST /server", h.handleCreateServer)
+	h.cfg.Mux.HandleFunc("GET /server/{id}", h.handleGetServer)
+	h.cfg.Mux.HandleFunc("PATCH /server/{id}", h.handleUpdateServer)
+	h.cfg.Mux.HandleFunc("DELETE /server/{id}", h.handleDeleteServer)
+	h.cfg.Mux.HandleFunc("POST /server/{id}/connect", h.handleConnectServer)
+	h.cfg.Mux.HandleFunc("POST /server/{id}/connect/{token}", h.handleConnectServerResponse)
+	return nil
+}
+
+// newServerID generates a new random server id.
+func newServerID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// serverExpired checks whether s has missed its heartbeats.
+func (h *Handler) serverExpired(s *server, now time.Time) bool {
+	return h.cfg.ServerTTL > 0 && now.Sub(s.Heartbeat) > h.cfg.ServerTTL
+}
+
+// getServer gets a copy of the server with the provided id.
+func (h *Handler) getServer(id string) (server, bool) {
+	h.serverMu.RLock()
+	defer h.serverMu.RUnlock()
+
+	s, ok := h.servers[id]
+	if !ok || h.serverExpired(s, time.Now()) {
+		return server{}, false
+	}
+	return *s, true
+}
+
+// removeServerLocked removes a server. h.serverMu must be held.
+func (h *Handler) removeServerLocked(s *server) {
+	delete(h.servers, s.ID)
+	if h.serverAddr[s.Addr] == s.ID {
+		delete(h.serverAddr, s.Addr)
+	}
+	h.publishServerLocked("remove", s)
+}
+
+// ownServerLocked gets the server with the provided id, ensuring it belongs to
+// the server verified by sess. h.serverMu must be held.
+func (h *Handler) ownServerLocked(id string, sessID int64, addr netip.AddrPort) (*server, error) {
+	s, ok := h.servers[id]
+	if !ok || h.serverExpired(s, time.Now()) {
+		return nil, Error{Code: ErrorCodeServerNotFound}
+	}
+	if s.SessionID != sessID || s.Addr != addr {
+		return nil, Error{Code: ErrorCodePermissionDenied, Message: "server belongs to another session"}
+	}
+	return s, nil
+}
+
+// runServerExpiry periodically removes servers which have missed their
+// heartbeats and expired password challenges until ctx is cancelled.
+func (h *Handler) runServerExpiry(ctx context.Context) {
+	t := time.NewTicker(serverExpiryInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		h.expireServers()
+		h.sweepServerPasswords()
+	}
+}
+
+// expireServers removes servers which have missed their heartbeats.
+func (h *Handler) expireServers() {
+	var n int
+	h.serverMu.Lock()
+	now := time.Now()
+	for _, s := range h.servers {
+		if h.serverExpired(s, now) {
+			h.removeServerLocked(s)
+			n++
+		}
+	}
+	h.serverMu.Unlock()
+
+	if n != 0 {
+		h.cfg.Logger.Info("removed expired servers", "servers", n)
+	}
+}
+
+// decodeServerMetadata decodes server metadata from the request body. An empty
+// body is treated as an empty update.
+func decodeServerMetadata(r *http.Request) (serverMetadata, error) {
+	var m serverMetadata
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxServerMetadataSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return serverMetadata{}, nil // no body, heartbeat only
+		}
+		return m, Error{Code: ErrorCodeBadRequest, Message: "invalid server metadata: " + err.Error()}
+	}
+	return m, nil
+}
+
+// apply sets the fields of s which are set in m.
+func (m serverMetadata) apply(s *server) {
+	if m.Name != nil {
+		s.Name = *m.Name
+	}
+	if m.Description != nil {
+		s.Description = *m.Description
+	}
+	if m.Map != nil {
+		s.Map = *m.Map
+	}
+	if m.Playlist != nil {
+		s.Playlist = *m.Playlist
+	}
+	if m.Players != nil {
+		s.Players = *m.Players
+	}
+	if m.MaxPlayers != nil {
+		s.MaxPlayers = *m.MaxPlayers
+	}
+	if m.Password != nil {
+		s.Password = *m.Password
+	}
+	if m.Mods != nil {
+		s.Mods = slices.Clone(*m.Mods)
+	}
+}
+
+// validateServer checks server metadata.
+func validateServer(s *server) error {
+	for _, f := range []struct {
+		Name     string
+		Value    string
+		Required bool
+		Max      int
+	}{
+		{"name", s.Name, true, 64},
+		{"description", s.Description, false, 1024},
+		{"map", s.Map, true, 64},
+		{"playlist", s.Playlist, true, 64},
+	} {
+		if f.Required && strings.TrimSpace(f.Value) == "" {
+			return Error{Code: ErrorCodeBadRequest, Message: f.Name + " is required", Field: f.Name}
+		}
+		if len(f.Value) > f.Max {
+			return Error{Code: ErrorCodeBadRequest, Message: f.Name + " is too long", Field: f.Name}
+		}
+		if !utf8.ValidString(f.Value) {
+			return Error{Code: ErrorCodeBadRequest, Message: f.Name + " is not valid utf-8", Field: f.Name}
+		}
+	}
+	if s.MaxPlayers <= 0 || s.MaxPlayers > 128 {
+		return Error{Code: ErrorCodeBadRequest, Message: "invalid max players", Field: "max_players"}
+	}
+	if s.Players < 0 || s.Players > s.MaxPlayers {
+		return Error{Code: ErrorCodeBadRequest, Message: "invalid player count", Field: "players"}
+	}
+	if len(s.Mods) > 256 {
+		return Error{Code: ErrorCodeBadRequest, Message: "too many mods", Field: "mods"}
+	}
+	for _, m := range s.Mods {
+		if m.Name == "" || len(m.Name) > 128 || len(m.Version) > 32 || !utf8.ValidString(m.Name) || !utf8.ValidString(m.Version) {
+			return Error{Code: ErrorCodeBadRequest, Message: "invalid mod " + m.Name, Field: "mods"}
+		}
+	}
 	return nil
 }
+
+// handleListServers gets the server list, or streams changes to it if
+// requested.
+func (h *Handler) handleListServers(w http.ResponseWriter, r *http.Request) {
+	if wantServerStream(r) {
+		h.streamServers(w, r)
+		return
+	}
+
+	h.serveServerList(w, r)
+}
+
+// handleCreateServer registers a new server for the current verified server
+// session, replacing any existing one for the same address.
+func (h *Handler) handleCreateServer(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.requireServer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if err := h.checkBan(r.Context(), 0, sess.ServerAddr.Addr(), sess.ServerAddr); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	m, err := decodeServerMetadata(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	s := &server{
+		SessionID: sess.ID,
+		Addr:      sess.ServerAddr,
+		Key:       sess.Key,
+	}
+	m.apply(s)
+	if err := validateServer(s); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	s.Region = h.getRegion(s.Addr.Addr())
+
+	h.serverMu.Lock()
+	defer h.serverMu.Unlock()
+
+	for {
+		id, err := newServerID()
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		if _, exists := h.servers[id]; !exists {
+			s.ID = id
+			break
+		}
+	}
+	if id, ok := h.serverAddr[s.Addr]; ok {
+		if old, ok := h.servers[id]; ok {
+			h.removeServerLocked(old)
+		}
+	}
+	s.Created = time.Now()
+	s.Heartbeat = s.Created
+	h.servers[s.ID] = s
+	h.serverAddr[s.Addr] = s.ID
+	h.publishServerLocked("add", s)
+
+	h.cfg.Logger.Info("registered server", "id", s.ID, "addr", s.Addr, "name", s.Name)
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"id":  s.ID,
+		"ttl": int(h.cfg.ServerTTL.Seconds()),
+	})
+}
+
+// handleGetServer gets a single server.
+func (h *Handler) handleGetServer(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.getServer(r.PathValue("id"))
+	if !ok {
+		Error{Code: ErrorCodeServerNotFound}.ServeHTTP(w, r)
+		return
+	}
+	respondJSON(w, r, http.StatusOK, json.RawMessage(appendServerJSON(nil, &s)))
+}
+
+// handleUpdateServer updates server metadata and records a heartbeat.
+func (h *Handler) handleUpdateServer(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.requireServer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	id := r.PathValue("id")
+
+	h.serverMu.RLock()
+	_, err = h.ownServerLocked(id, sess.ID, sess.ServerAddr)
+	h.serverMu.RUnlock()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if err := h.checkBan(r.Context(), 0, sess.ServerAddr.Addr(), sess.ServerAddr); err != nil {
+		var e Error
+		if errors.As(err, &e) && e.Code == ErrorCodeBanned {
+			h.serverMu.Lock()
+			if cur, err := h.ownServerLocked(id, sess.ID, sess.ServerAddr); err == nil {
+				h.removeServerLocked(cur)
+			}
+			h.serverMu.Unlock()
+			h.cfg.Logger.Info("removed banned server", "id", id, "addr", sess.ServerAddr)
+		}
+		respondError(w, r, err)
+		return
+	}
+
+	m, err := decodeServerMetadata(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	h.serverMu.Lock()
+	cur, err := h.ownServerLocked(id, sess.ID, sess.ServerAddr)
+	if err != nil {
+		h.serverMu.Unlock()
+		respondError(w, r, err)
+		return
+	}
+	s := *cur
+	m.apply(&s)
+	if err := validateServer(&s); err != nil {
+		h.serverMu.Unlock()
+		respondError(w, r, err)
+		return
+	}
+	s.Heartbeat = time.Now()
+	changed := !bytes.Equal(appendServerJSON(nil, cur), appendServerJSON(nil, &s))
+	*cur = s
+	if changed {
+		h.publishServerLocked("update", cur)
+	}
+	h.serverMu.Unlock()
+
+	respondJSON(w, r, http.StatusOK, json.RawMessage(appendServerJSON(nil, &s)))
+}
+
+// handleDeleteServer immediately removes a server.
+func (h *Handler) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.requireServer(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	h.serverMu.Lock()
+	s, err := h.ownServerLocked(r.PathValue("id"), sess.ID, sess.ServerAddr)
+	if err == nil {
+		h.removeServerLocked(s)
+	}
+	h.serverMu.Unlock()
+
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	h.cfg.Logger.Info("removed server", "id", s.ID, "addr", s.Addr)
+
+	respondJSON(w, r, http.StatusOK, map[string]any{
+		"id": s.ID,
+	})
+}
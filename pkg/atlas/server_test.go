@@ -0,0 +1,250 @@
+package atlas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServerMetadata is valid metadata for registering a server.
+var testServerMetadata = map[string]any{
+	"name":        "test",
+	"map":         "mp_glitch",
+	"playlist":    "ps",
+	"max_players": 16,
+}
+
+// listServers gets the server list.
+func listServers(t *testing.T, srv *httptest.Server) []map[string]any {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + "/server")
+	if err != nil {
+		t.Fatalf("list servers: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var list []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("list servers: decode response: %v", err)
+	}
+	return list
+}
+
+// registerServer registers a server, returning its id.
+func (c *testClient) registerServer(t *testing.T) string {
+	t.Helper()
+	status, obj := c.do(t, context.Background(), "POST", "/server", testServerMetadata)
+	if status != http.StatusOK {
+		t.Fatalf("register server: status %d: %v", status, obj)
+	}
+	return obj["id"].(string)
+}
+
+func TestServer(t *testing.T) {
+	h, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+
+	t.Run("Register", func(t *testing.T) {
+		c, _ := newTestServer(t, srv)
+
+		status, obj := c.do(t, context.Background(), "POST", "/server", map[string]any{
+			"name":        "test",
+			"map":         "mp_glitch",
+			"max_players": 16,
+		})
+		if code := errorCode(obj); status != http.StatusBadRequest || code != ErrorCodeBadRequest {
+			t.Fatalf("expected %s for missing playlist, got status %d: %v", ErrorCodeBadRequest, status, obj)
+		}
+		if field := obj["error"].(map[string]any)["field"]; field != "playlist" {
+			t.Errorf("expected error field playlist, got %v", field)
+		}
+
+		status, obj = c.do(t, context.Background(), "POST", "/server", testServerMetadata)
+		if status != http.StatusOK {
+			t.Fatalf("register server: status %d: %v", status, obj)
+		}
+		id := obj["id"].(string)
+		if ttl := obj["ttl"]; ttl != h.cfg.ServerTTL.Seconds() {
+			t.Errorf("expected ttl %v, got %v", h.cfg.ServerTTL.Seconds(), ttl)
+		}
+
+		status, obj = c.do(t, context.Background(), "GET", "/server/"+id, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get server: status %d: %v", status, obj)
+		}
+		if obj["name"] != "test" || obj["map"] != "mp_glitch" || obj["playlist"] != "ps" || obj["max_players"] != 16.0 || obj["players"] != 0.0 {
+			t.Errorf("unexpected server %v", obj)
+		}
+
+		var found bool
+		for _, s := range listServers(t, srv) {
+			if s["id"] == id {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("server %s not in server list", id)
+		}
+
+		// registering again replaces the old server
+		newID := c.registerServer(t)
+		if status, obj := c.do(t, context.Background(), "GET", "/server/"+id, nil); errorCode(obj) != ErrorCodeServerNotFound {
+			t.Errorf("expected %s for replaced server, got status %d: %v", ErrorCodeServerNotFound, status, obj)
+		}
+		if status, _ := c.do(t, context.Background(), "GET", "/server/"+newID, nil); status != http.StatusOK {
+			t.Errorf("expected new server to exist, got status %d", status)
+		}
+	})
+
+	t.Run("RequireServer", func(t *testing.T) {
+		c := newTestPlayer(t, srv, 1)
+		if status, obj := c.do(t, context.Background(), "POST", "/server", testServerMetadata); errorCode(obj) != ErrorCodeAuthServerMissing {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodeAuthServerMissing, status, obj)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		c, _ := newTestServer(t, srv)
+		for _, method := range []string{"GET", "PATCH", "DELETE"} {
+			if status, obj := c.do(t, context.Background(), method, "/server/0000000000000000", nil); status != http.StatusNotFound || errorCode(obj) != ErrorCodeServerNotFound {
+				t.Errorf("%s: expected %s, got status %d: %v", method, ErrorCodeServerNotFound, status, obj)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		c, _ := newTestServer(t, srv)
+		id := c.registerServer(t)
+
+		status, obj := c.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{
+			"players": 3,
+		})
+		if status != http.StatusOK {
+			t.Fatalf("update server: status %d: %v", status, obj)
+		}
+		if obj["players"] != 3.0 || obj["name"] != "test" {
+			t.Errorf("expected only players to change, got %v", obj)
+		}
+
+		// heartbeat only
+		if status, obj := c.do(t, context.Background(), "PATCH", "/server/"+id, nil); status != http.StatusOK || obj["players"] != 3.0 {
+			t.Errorf("heartbeat: status %d: %v", status, obj)
+		}
+
+		// invalid updates aren't applied
+		if status, obj := c.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{
+			"description": "changed",
+			"players":     17,
+		}); errorCode(obj) != ErrorCodeBadRequest {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodeBadRequest, status, obj)
+		}
+		if _, obj := c.do(t, context.Background(), "GET", "/server/"+id, nil); obj["players"] != 3.0 || obj["description"] != "" {
+			t.Errorf("expected invalid update to be ignored, got %v", obj)
+		}
+
+		// only the session which registered it can update it
+		d, _ := newTestServer(t, srv)
+		if status, obj := d.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{"players": 1}); errorCode(obj) != ErrorCodePermissionDenied {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodePermissionDenied, status, obj)
+		}
+	})
+
+	t.Run("ConcurrentUpdate", func(t *testing.T) {
+		c, _ := newTestServer(t, srv)
+		id := c.registerServer(t)
+
+		const n = 20
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= n; i++ {
+				c.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{"players": i % 16})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= n; i++ {
+				c.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{"description": strconv.Itoa(i)})
+			}
+		}()
+		wg.Wait()
+
+		// neither update may overwrite the other's field with a stale value
+		_, obj := c.do(t, context.Background(), "GET", "/server/"+id, nil)
+		if obj["players"] != float64(n%16) || obj["description"] != strconv.Itoa(n) {
+			t.Errorf("lost update: got %v", obj)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		c, _ := newTestServer(t, srv)
+		id := c.registerServer(t)
+
+		d, _ := newTestServer(t, srv)
+		if status, obj := d.do(t, context.Background(), "DELETE", "/server/"+id, nil); errorCode(obj) != ErrorCodePermissionDenied {
+			t.Errorf("expected %s, got status %d: %v", ErrorCodePermissionDenied, status, obj)
+		}
+
+		if status, obj := c.do(t, context.Background(), "DELETE", "/server/"+id, nil); status != http.StatusOK {
+			t.Fatalf("delete server: status %d: %v", status, obj)
+		}
+		for _, method := range []string{"GET", "PATCH", "DELETE"} {
+			if status, obj := c.do(t, context.Background(), method, "/server/"+id, nil); errorCode(obj) != ErrorCodeServerNotFound {
+				t.Errorf("%s: expected %s, got status %d: %v", method, ErrorCodeServerNotFound, status, obj)
+			}
+		}
+		for _, s := range listServers(t, srv) {
+			if s["id"] == id {
+				t.Errorf("deleted server %s still in server list", id)
+			}
+		}
+	})
+}
+
+func TestServerExpiry(t *testing.T) {
+	h, srv := newTestHandler(t, Config{
+		Listener:  newTestListener(t),
+		ServerTTL: time.Second,
+	})
+
+	c, _ := newTestServer(t, srv)
+	id := c.registerServer(t)
+
+	// a heartbeat keeps it alive
+	time.Sleep(time.Second * 6 / 10)
+	if status, obj := c.do(t, context.Background(), "PATCH", "/server/"+id, nil); status != http.StatusOK {
+		t.Fatalf("heartbeat: status %d: %v", status, obj)
+	}
+	time.Sleep(time.Second * 6 / 10)
+	if status, obj := c.do(t, context.Background(), "GET", "/server/"+id, nil); status != http.StatusOK {
+		t.Fatalf("expected server to exist after heartbeat, got status %d: %v", status, obj)
+	}
+
+	// expired servers are hidden immediately, and removed by expireServers
+	time.Sleep(time.Second * 6 / 10)
+	other, _ := newTestServer(t, srv)
+	otherID := other.registerServer(t)
+	for _, method := range []string{"GET", "PATCH"} {
+		if status, obj := c.do(t, context.Background(), method, "/server/"+id, nil); errorCode(obj) != ErrorCodeServerNotFound {
+			t.Errorf("%s: expected %s for expired server, got status %d: %v", method, ErrorCodeServerNotFound, status, obj)
+		}
+	}
+	if list := listServers(t, srv); len(list) != 1 || list[0]["id"] != otherID {
+		t.Errorf("expected only %s in server list, got %v", otherID, list)
+	}
+
+	h.expireServers()
+
+	h.serverMu.RLock()
+	_, exists := h.servers[id]
+	n := len(h.servers)
+	h.serverMu.RUnlock()
+	if exists || n != 1 {
+		t.Errorf("expected only the expired server to be removed, got %d servers", n)
+	}
+}
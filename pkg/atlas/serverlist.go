@@ -0,0 +1,223 @@
+package atlas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/r2northstar/atlas/v2/pkg/jsonx"
+)
+
+// serverListZstd compresses server list responses. EncodeAll is safe for
+// concurrent use.
+var serverListZstd, _ = zstd.NewWriter(nil,
+	zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+	zstd.WithEncoderConcurrency(1))
+
+// serverList is a rendered server list response.
+type serverList struct {
+	Gen     uint64    // h.serverListGen when rendered
+	Expires time.Time // when the next server expires, or zero
+	Hash    string    // truncated hex sha256 of Raw
+	Raw     []byte
+	Gzip    []byte // nil if it isn't smaller than Raw
+	Zstd    []byte // nil if it isn't smaller than Raw
+}
+
+// appendServerJSON appends the public JSON representation of s.
+func appendServerJSON(b []byte, s *server) []byte {
+	b = append(jsonx.AppendString(append(b, '{'), "id"), ':')
+	b = jsonx.AppendString(b, s.ID)
+	b = append(jsonx.AppendString(append(b, ','), "region"), ':')
+	b = jsonx.AppendString(b, s.Region)
+	b = append(jsonx.AppendString(append(b, ','), "name"), ':')
+	b = jsonx.AppendString(b, s.Name)
+	b = append(jsonx.AppendString(append(b, ','), "description"), ':')
+	b = jsonx.AppendString(b, s.Description)
+	b = append(jsonx.AppendString(append(b, ','), "map"), ':')
+	b = jsonx.AppendString(b, s.Map)
+	b = append(jsonx.AppendString(append(b, ','), "playlist"), ':')
+	b = jsonx.AppendString(b, s.Playlist)
+	b = append(jsonx.AppendString(append(b, ','), "players"), ':')
+	b = jsonx.AppendInt(b, s.Players)
+	b = append(jsonx.AppendString(append(b, ','), "max_players"), ':')
+	b = jsonx.AppendInt(b, s.MaxPlayers)
+	b = append(jsonx.AppendString(append(b, ','), "password"), ':')
+	b = jsonx.AppendBool(b, s.Password)
+	b = append(jsonx.AppendString(append(b, ','), "mods"), ':', '[')
+	for i, m := range s.Mods {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = append(jsonx.AppendString(append(b, '{'), "name"), ':')
+		b = jsonx.AppendString(b, m.Name)
+		b = append(jsonx.AppendString(append(b, ','), "version"), ':')
+		b = jsonx.AppendString(b, m.Version)
+		b = append(jsonx.AppendString(append(b, ','), "required"), ':')
+		b = jsonx.AppendBool(b, m.Required)
+		b = append(b, '}')
+	}
+	b = append(b, ']', '}')
+	return b
+}
+
+// appendServerListLocked appends the sorted server list, returning the time
+// the next server expires, or zero if none will. h.serverMu must be held.
+func (h *Handler) appendServerListLocked(b []byte) ([]byte, time.Time) {
+	now := time.Now()
+	ss := make([]*server, 0, len(h.servers))
+	for _, s := range h.servers {
+		if !h.serverExpired(s, now) {
+			ss = append(ss, s)
+		}
+	}
+
+	slices.SortFunc(ss, func(a, b *server) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	var expires time.Time
+	b = append(b, '[')
+	for i, s := range ss {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = appendServerJSON(b, s)
+		if h.cfg.ServerTTL > 0 {
+			if t := s.Heartbeat.Add(h.cfg.ServerTTL); expires.IsZero() || t.Before(expires) {
+				expires = t
+			}
+		}
+	}
+	b = append(b, ']')
+	return b, expires
+}
+
+// getServerList gets the rendered server list, rendering it again if it has
+// changed since the last time.
+func (h *Handler) getServerList() *serverList {
+	valid := func(c *serverList) bool {
+		return c != nil && c.Gen == h.serverListGen.Load() && (c.Expires.IsZero() || time.Now().Before(c.Expires))
+	}
+	if c := h.serverList.Load(); valid(c) {
+		return c
+	}
+
+	h.serverListMu.Lock()
+	defer h.serverListMu.Unlock()
+
+	if c := h.serverList.Load(); valid(c) {
+		return c
+	}
+
+	var c serverList
+	if old := h.serverList.Load(); old != nil {
+		c.Raw = make([]byte, 0, len(old.Raw))
+	}
+
+	h.serverMu.RLock()
+	c.Gen = h.serverListGen.Load()
+	c.Raw, c.Expires = h.appendServerListLocked(c.Raw)
+	h.serverMu.RUnlock()
+
+	hash := sha256.Sum256(c.Raw)
+	c.Hash = hex.EncodeToString(hash[:16])
+
+	var gz bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	zw.Write(c.Raw)
+	zw.Close()
+	if gz.Len() < len(c.Raw) {
+		c.Gzip = gz.Bytes()
+	}
+
+	if zs := serverListZstd.EncodeAll(c.Raw, nil); len(zs) < len(c.Raw) {
+		c.Zstd = zs
+	}
+
+	h.serverList.Store(&c)
+	return &c
+}
+
+// serverListEncoding chooses the best content encoding for c accepted by r,
+// returning an empty string for identity.
+func serverListEncoding(r *http.Request, c *serverList) string {
+	var (
+		enc  string
+		encQ = 0.0
+	)
+	for _, x := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(x, ";")
+
+		var e string
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "zstd":
+			if c.Zstd != nil {
+				e = "zstd"
+			}
+		case "gzip":
+			if c.Gzip != nil {
+				e = "gzip"
+			}
+		}
+		if e == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "q" {
+				if v, err := strconv.ParseFloat(v, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 && (q > encQ || (q == encQ && e == "zstd")) {
+			enc, encQ = e, q
+		}
+	}
+	return enc
+}
+
+// serveServerList writes the rendered server list.
+func (h *Handler) serveServerList(w http.ResponseWriter, r *http.Request) {
+	c := h.getServerList()
+
+	enc := serverListEncoding(r, c)
+	buf, etag := c.Raw, `"`+c.Hash+`"`
+	switch enc {
+	case "gzip":
+		buf, etag = c.Gzip, `"`+c.Hash+`-gzip"`
+	case "zstd":
+		buf, etag = c.Zstd, `"`+c.Hash+`-zstd"`
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Encoding")
+	w.Header().Set("ETag", etag)
+
+	if matchETag(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if enc != "" {
+		w.Header().Set("Content-Encoding", enc)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(buf)
+	}
+}
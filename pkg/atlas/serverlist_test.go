@@ -0,0 +1,196 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// getServerListRaw gets the server list with the provided Accept-Encoding and
+// If-None-Match headers, returning the response and decoded body.
+func getServerListRaw(t *testing.T, srv *httptest.Server, encoding, etag string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", srv.URL+"/server", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	req.Header.Set("Accept-Encoding", encoding) // also disables transparent decompression
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("get server list: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	switch ce := resp.Header.Get("Content-Encoding"); ce {
+	case "":
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("get server list: decode gzip: %v", err)
+		}
+		r = zr
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatalf("get server list: decode zstd: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("get server list: unexpected content encoding %q", ce)
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("get server list: read body: %v", err)
+	}
+	return resp, buf
+}
+
+func TestServerList(t *testing.T) {
+	h, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+
+	var ids []string
+	for range 3 {
+		s, _ := newTestServer(t, srv)
+		id := s.registerServer(t)
+		s.do(t, context.Background(), "PATCH", "/server/"+id, map[string]any{
+			"description": strings.Repeat("description ", 8),
+			"mods":        []map[string]any{{"name": "Northstar.Client", "version": "1.0.0", "required": false}},
+		})
+		ids = append(ids, id)
+	}
+
+	resp, raw := getServerListRaw(t, srv, "identity", "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected response: status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var list []map[string]any
+		if err := json.Unmarshal(raw, &list); err != nil {
+			t.Fatalf("decode server list: %v", err)
+		}
+		if len(list) != len(ids) {
+			t.Fatalf("expected %d servers, got %d", len(ids), len(list))
+		}
+		c := newTestSession(t, srv)
+		for i, s := range list {
+			if s["id"] != ids[i] {
+				t.Errorf("expected servers in registration order, got %v at %d", s["id"], i)
+			}
+			// the rendered list must match the individual server json
+			if _, obj := c.do(t, context.Background(), "GET", "/server/"+ids[i], nil); !jsonEqual(t, s, obj) {
+				t.Errorf("server list entry %v doesn't match server %v", s, obj)
+			}
+		}
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		if resp, _ := getServerListRaw(t, srv, "identity", etag); resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != etag {
+			t.Errorf("expected 304 with the same ETag, got status %d, etag %q", resp.StatusCode, resp.Header.Get("ETag"))
+		}
+		if resp, _ := getServerListRaw(t, srv, "identity", `"other", `+etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("expected 304 for a list of etags, got status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Precompressed", func(t *testing.T) {
+		for _, tc := range []struct {
+			AcceptEncoding  string
+			ContentEncoding string
+		}{
+			{"gzip", "gzip"},
+			{"zstd", "zstd"},
+			{"gzip, zstd", "zstd"},
+			{"gzip;q=1, zstd;q=0.5", "gzip"},
+			{"gzip;q=0, br", ""},
+		} {
+			resp, buf := getServerListRaw(t, srv, tc.AcceptEncoding, "")
+			if ce := resp.Header.Get("Content-Encoding"); ce != tc.ContentEncoding {
+				t.Errorf("%s: expected content encoding %q, got %q", tc.AcceptEncoding, tc.ContentEncoding, ce)
+				continue
+			}
+			if !bytes.Equal(buf, raw) {
+				t.Errorf("%s: decoded server list doesn't match", tc.AcceptEncoding)
+			}
+
+			encETag := resp.Header.Get("ETag")
+			if (tc.ContentEncoding == "") != (encETag == etag) {
+				t.Errorf("%s: expected a different ETag for each encoding, got %q (identity %q)", tc.AcceptEncoding, encETag, etag)
+			}
+			if resp, _ := getServerListRaw(t, srv, tc.AcceptEncoding, encETag); resp.StatusCode != http.StatusNotModified {
+				t.Errorf("%s: expected 304, got status %d", tc.AcceptEncoding, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		before := h.getServerList()
+		if h.getServerList() != before {
+			t.Errorf("expected the rendered list to be reused")
+		}
+
+		s, _ := newTestServer(t, srv)
+		id := s.registerServer(t)
+
+		resp, _ := getServerListRaw(t, srv, "identity", etag)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+			t.Errorf("expected a new ETag after registering a server, got status %d", resp.StatusCode)
+		}
+		etag := resp.Header.Get("ETag")
+
+		s.do(t, context.Background(), "DELETE", "/server/"+id, nil)
+		if resp, _ := getServerListRaw(t, srv, "identity", etag); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected a new ETag after removing a server, got status %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestServerListExpiry(t *testing.T) {
+	_, srv := newTestHandler(t, Config{
+		Listener:  newTestListener(t),
+		ServerTTL: time.Second,
+	})
+	s, _ := newTestServer(t, srv)
+	s.registerServer(t)
+
+	if _, buf := getServerListRaw(t, srv, "identity", ""); bytes.Equal(buf, []byte("[]")) {
+		t.Fatalf("expected the server to be listed")
+	}
+
+	// the cached list is rendered again when a server expires, even if
+	// expireServers hasn't run yet
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if _, buf := getServerListRaw(t, srv, "identity", ""); !bytes.Equal(buf, []byte("[]")) {
+		t.Errorf("expected the expired server to be removed, got %s", buf)
+	}
+}
+
+// jsonEqual checks whether a and b have the same JSON representation.
+func jsonEqual(t *testing.T, a, b any) bool {
+	t.Helper()
+	ab, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("encode json: %v", err)
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("encode json: %v", err)
+	}
+	return bytes.Equal(ab, bb)
+}
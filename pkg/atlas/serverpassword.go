@@ -0,0 +1,122 @@
+package atlas
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// serverPasswordNonceTTL is how long a player has to retry a connection
+	// with the password HMAC after the server returns a nonce.
+	serverPasswordNonceTTL = time.Minute
+
+	// maxServerPasswordFailures is the number of failed password attempts a
+	// player can make for a single server within serverPasswordFailureWindow.
+	maxServerPasswordFailures = 5
+
+	// serverPasswordFailureWindow is the period over which failed password
+	// attempts are counted.
+	serverPasswordFailureWindow = 5 * time.Minute
+)
+
+// serverPasswordKey identifies password attempts by a player for a server.
+type serverPasswordKey struct {
+	UID      uint64
+	ServerID string
+}
+
+// serverPassword is the password challenge state for a player and server.
+type serverPassword struct {
+	Nonce        string // from the last password_required response
+	NonceExpires time.Time
+	Failures     int
+	WindowEnd    time.Time // when Failures is reset
+}
+
+// expired checks whether p can be removed.
+func (p *serverPassword) expired(now time.Time) bool {
+	return now.After(p.NonceExpires) && now.After(p.WindowEnd)
+}
+
+// parseServerPassword validates the password HMAC from the client.
+func parseServerPassword(s string) error {
+	if b, err := hex.DecodeString(s); err != nil || len(b) != 32 {
+		return Error{Code: ErrorCodeBadRequest, Message: "password must be a hex-encoded HMAC-SHA256", Field: "password"}
+	}
+	return nil
+}
+
+// checkServerPasswordLimit checks whether the player has made too many failed
+// password attempts for the server, returning how long until they can try
+// again.
+func (h *Handler) checkServerPasswordLimit(key serverPasswordKey) (time.Duration, bool) {
+	h.passwordMu.Lock()
+	defer h.passwordMu.Unlock()
+
+	if p, ok := h.password[key]; ok {
+		if now := time.Now(); p.Failures >= maxServerPasswordFailures && now.Before(p.WindowEnd) {
+			return p.WindowEnd.Sub(now), true
+		}
+	}
+	return 0, false
+}
+
+// takeServerPasswordNonce gets and clears the last nonce issued by the server
+// to the player.
+func (h *Handler) takeServerPasswordNonce(key serverPasswordKey) (string, bool) {
+	h.passwordMu.Lock()
+	defer h.passwordMu.Unlock()
+
+	p, ok := h.password[key]
+	if !ok || p.Nonce == "" || time.Now().After(p.NonceExpires) {
+		return "", false
+	}
+	nonce := p.Nonce
+	p.Nonce = ""
+	return nonce, true
+}
+
+// recordServerPasswordResult updates the password challenge state using the
+// result of a connection.
+func (h *Handler) recordServerPasswordResult(key serverPasswordKey, attempted bool, res connectResult) {
+	h.passwordMu.Lock()
+	defer h.passwordMu.Unlock()
+
+	now := time.Now()
+
+	p, ok := h.password[key]
+	if !ok {
+		p = new(serverPassword)
+	}
+	if res.Result == "ok" {
+		delete(h.password, key)
+		return
+	}
+	if attempted {
+		if now.After(p.WindowEnd) {
+			p.Failures = 0
+			p.WindowEnd = now.Add(serverPasswordFailureWindow)
+		}
+		p.Failures++
+	}
+	if res.Result == "password_required" {
+		p.Nonce = res.Nonce
+		p.NonceExpires = now.Add(serverPasswordNonceTTL)
+	}
+	if !p.expired(now) {
+		h.password[key] = p
+	}
+}
+
+// sweepServerPasswords removes expired password challenge state.
+func (h *Handler) sweepServerPasswords() {
+	h.passwordMu.Lock()
+	defer h.passwordMu.Unlock()
+
+	now := time.Now()
+	for k, p := range h.password {
+		if p.expired(now) {
+			delete(h.password, k)
+		}
+	}
+}
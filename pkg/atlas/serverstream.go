@@ -0,0 +1,127 @@
+package atlas
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r2northstar/atlas/v2/pkg/jsonx"
+)
+
+// serverStreamKeepalive is how often a comment is sent on idle server list
+// streams to keep the connection open.
+const serverStreamKeepalive = 30 * time.Second
+
+// serverEvent is an encoded server list change.
+type serverEvent struct {
+	Type string // add, update, remove
+	Data []byte
+}
+
+// wantServerStream checks whether r is requesting a server list stream.
+func wantServerStream(r *http.Request) bool {
+	if r.URL.Query().Get("stream") == "1" {
+		return true
+	}
+	for _, x := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := strings.Cut(x, ";")
+		if strings.EqualFold(strings.TrimSpace(mt), "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// publishServerLocked invalidates the rendered server list and sends a change
+// to all stream subscribers. Subscribers which aren't keeping up are
+// disconnected so they can reconnect and get a new snapshot. h.serverMu must
+// be held.
+func (h *Handler) publishServerLocked(typ string, s *server) {
+	h.serverListGen.Add(1)
+
+	if len(h.serverSubs) == 0 {
+		return
+	}
+
+	var buf []byte
+	if typ == "remove" {
+		buf = append(jsonx.AppendString(append(buf, '{'), "id"), ':')
+		buf = append(jsonx.AppendString(buf, s.ID), '}')
+	} else {
+		buf = appendServerJSON(buf, s)
+	}
+
+	ev := serverEvent{Type: typ, Data: buf}
+	for c := range h.serverSubs {
+		select {
+		case c <- ev:
+		default:
+			delete(h.serverSubs, c)
+			close(c)
+		}
+	}
+}
+
+// streamServers streams server list changes as server-sent events, starting
+// with a snapshot of the current list.
+func (h *Handler) streamServers(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		Error{Code: ErrorCodeInternalError, Message: "cannot stream events"}.ServeHTTP(w, r)
+		return
+	}
+
+	c := make(chan serverEvent, 64)
+
+	h.serverMu.Lock()
+	if h.shutdown.Load() {
+		h.serverMu.Unlock()
+		respondError(w, r, errShuttingDown)
+		return
+	}
+	list, _ := h.appendServerListLocked(nil)
+	h.serverSubs[c] = struct{}{}
+	h.serverMu.Unlock()
+
+	defer func() {
+		h.serverMu.Lock()
+		if _, ok := h.serverSubs[c]; ok {
+			delete(h.serverSubs, c)
+			close(c)
+		}
+		h.serverMu.Unlock()
+	}()
+
+	w.Header().Set("Cache-Control", "private, no-cache, no-store")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	io.WriteString(w, "event: snapshot\ndata: ")
+	w.Write(list)
+	io.WriteString(w, "\n\n")
+	f.Flush()
+
+	t := time.NewTicker(serverStreamKeepalive)
+	defer t.Stop()
+
+	for {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				return // too slow or shutting down, so the client should reconnect
+			}
+			io.WriteString(w, "event: "+ev.Type+"\ndata: ")
+			w.Write(ev.Data)
+			io.WriteString(w, "\n\n")
+			f.Flush()
+		case <-t.C:
+			io.WriteString(w, ": keepalive\n\n")
+			f.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
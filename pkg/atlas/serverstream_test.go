@@ -0,0 +1,164 @@
+package atlas
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServerEvent is a server-sent event.
+type testServerEvent struct {
+	Type string
+	Data string
+}
+
+// streamServers opens a server list stream, returning a channel of events which
+// is closed when the stream ends.
+func streamServers(t *testing.T, ctx context.Context, srv *httptest.Server, accept bool) <-chan testServerEvent {
+	t.Helper()
+
+	path := "/server?stream=1"
+	if accept {
+		path = "/server"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	if accept {
+		req.Header.Set("Accept", "application/json;q=0.9, text/event-stream")
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("stream servers: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		resp.Body.Close()
+		t.Fatalf("stream servers: status %d, content type %q", resp.StatusCode, ct)
+	}
+
+	ch := make(chan testServerEvent, 64)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		var ev testServerEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			switch line := sc.Text(); {
+			case line == "":
+				if ev.Type != "" {
+					ch <- ev
+				}
+				ev = testServerEvent{}
+			case strings.HasPrefix(line, "event: "):
+				ev.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return ch
+}
+
+// nextServerEvent waits for the next event, decoding its data into v.
+func nextServerEvent(t *testing.T, ch <-chan testServerEvent, typ string, v any) {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatalf("expected %s event, got end of stream", typ)
+		}
+		if ev.Type != typ {
+			t.Fatalf("expected %s event, got %s: %s", typ, ev.Type, ev.Data)
+		}
+		if err := json.Unmarshal([]byte(ev.Data), v); err != nil {
+			t.Fatalf("decode %s event: %v", typ, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s event", typ)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	h, srv := newTestHandler(t, Config{Listener: newTestListener(t)})
+	s, _ := newTestServer(t, srv)
+	id := s.registerServer(t)
+
+	t.Run("Events", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := streamServers(t, ctx, srv, false)
+
+		var list []map[string]any
+		if nextServerEvent(t, ch, "snapshot", &list); len(list) != 1 || list[0]["id"] != id {
+			t.Errorf("expected snapshot with %s, got %v", id, list)
+		}
+
+		d, _ := newTestServer(t, srv)
+		newID := d.registerServer(t)
+
+		var obj map[string]any
+		if nextServerEvent(t, ch, "add", &obj); obj["id"] != newID || obj["name"] != "test" {
+			t.Errorf("unexpected add event %v", obj)
+		}
+
+		d.do(t, context.Background(), "PATCH", "/server/"+newID, nil) // heartbeat only, so no event
+		d.do(t, context.Background(), "PATCH", "/server/"+newID, map[string]any{"players": 2})
+		obj = nil
+		if nextServerEvent(t, ch, "update", &obj); obj["id"] != newID || obj["players"] != 2.0 {
+			t.Errorf("unexpected update event %v", obj)
+		}
+
+		d.do(t, context.Background(), "DELETE", "/server/"+newID, nil)
+		obj = nil
+		if nextServerEvent(t, ch, "remove", &obj); obj["id"] != newID || len(obj) != 1 {
+			t.Errorf("unexpected remove event %v", obj)
+		}
+
+		cancel()
+		waitFor(t, "stream unsubscribe", func() bool {
+			h.serverMu.RLock()
+			defer h.serverMu.RUnlock()
+			return len(h.serverSubs) == 0
+		})
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := streamServers(t, ctx, srv, true)
+
+		var list []map[string]any
+		if nextServerEvent(t, ch, "snapshot", &list); len(list) != 1 || list[0]["id"] != id {
+			t.Errorf("expected snapshot with %s, got %v", id, list)
+		}
+	})
+
+	t.Run("SlowSubscriber", func(t *testing.T) {
+		c := make(chan serverEvent, 1)
+
+		h.serverMu.Lock()
+		h.serverSubs[c] = struct{}{}
+		cur := h.servers[id]
+		h.publishServerLocked("update", cur)
+		h.publishServerLocked("update", cur) // buffer is full
+		_, subscribed := h.serverSubs[c]
+		h.serverMu.Unlock()
+
+		if subscribed {
+			t.Errorf("expected slow subscriber to be removed")
+		}
+		if ev, ok := <-c; !ok || ev.Type != "update" {
+			t.Errorf("expected the buffered event to be kept")
+		}
+		if _, ok := <-c; ok {
+			t.Errorf("expected slow subscriber channel to be closed")
+		}
+	})
+}
@@ -364,20 +364,32 @@ func (l *Listener) Monitor(ctx context.Context, c chan<- MonitorPacket) {
 
 // WritePrometheus writes prometheus text metrics to w.
 func (l *Listener) WritePrometheus(w io.Writer) {
+	fmt.Fprintln(w, `# HELP atlas_nspkt_rx_count Received packets by type.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_rx_count counter`)
 	fmt.Fprintln(w, `atlas_nspkt_rx_count{type="invalid"}`, l.metrics.rx_count.invalid.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_count{type="ignored"}`, l.metrics.rx_count.ignored.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_count{type="r2_connect_resp"}`, l.metrics.rx_count.r2_connect_resp.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_count{type="other"}`, l.metrics.rx_count.other.Load())
+	fmt.Fprintln(w, `# HELP atlas_nspkt_rx_bytes Received bytes by packet type.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_rx_bytes counter`)
 	fmt.Fprintln(w, `atlas_nspkt_rx_bytes{type="invalid"}`, l.metrics.rx_bytes.invalid.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_bytes{type="ignored"}`, l.metrics.rx_bytes.ignored.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_bytes{type="r2_connect_resp"}`, l.metrics.rx_bytes.r2_connect_resp.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_bytes{type="other"}`, l.metrics.rx_bytes.other.Load())
+	fmt.Fprintln(w, `# HELP atlas_nspkt_tx_count Sent packets by type.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_tx_count counter`)
 	fmt.Fprintln(w, `atlas_nspkt_tx_count{type="atlas_sigreq1"}`, l.metrics.tx_count.atlas_sigreq1.Load())
 	fmt.Fprintln(w, `atlas_nspkt_tx_count{type="r2_connect"}`, l.metrics.tx_count.r2_connect.Load())
+	fmt.Fprintln(w, `# HELP atlas_nspkt_tx_bytes Sent bytes by packet type.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_tx_bytes counter`)
 	fmt.Fprintln(w, `atlas_nspkt_tx_bytes{type="atlas_sigreq1"}`, l.metrics.tx_bytes.atlas_sigreq1.Load())
 	fmt.Fprintln(w, `atlas_nspkt_tx_bytes{type="r2_connect"}`, l.metrics.tx_bytes.r2_connect.Load())
+	fmt.Fprintln(w, `# HELP atlas_nspkt_tx_err_count Packet send errors by cause.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_tx_err_count counter`)
 	fmt.Fprintln(w, `atlas_nspkt_tx_err_count{cause="nonce"}`, l.metrics.tx_err_count.nonce.Load())
 	fmt.Fprintln(w, `atlas_nspkt_tx_err_count{cause="conn"}`, l.metrics.tx_err_count.conn.Load())
+	fmt.Fprintln(w, `# HELP atlas_nspkt_rx_wait_count Waits for a response packet by type and result.`)
+	fmt.Fprintln(w, `# TYPE atlas_nspkt_rx_wait_count counter`)
 	fmt.Fprintln(w, `atlas_nspkt_rx_wait_count{type="r2_connect_resp",result="timeout"}`, l.metrics.rx_wait_count.r2_connect_resp.timeout.Load())
 	fmt.Fprintln(w, `atlas_nspkt_rx_wait_count{type="r2_connect_resp",result="success"}`, l.metrics.rx_wait_count.r2_connect_resp.success.Load())
 }
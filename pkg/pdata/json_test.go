@@ -0,0 +1,60 @@
+package pdata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	var base Pdata
+	if err := base.UnmarshalBinary(DefaultPdata); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	for _, tc := range []struct {
+		Name  string
+		JSON  string
+		Error error
+		Match string
+		Check func(pd Pdata) bool
+	}{
+		{Name: "Partial", JSON: `{"xp":5,"lastAbandonedMode":"ctf","ranked":{"currentRank":3}}`, Check: func(pd Pdata) bool {
+			return pd.Xp == 5 && pd.LastAbandonedMode == GameModes_ctf && pd.Ranked.CurrentRank == 3 && pd.Credits == base.Credits
+		}},
+		{Name: "UnknownEnumNumber", JSON: `{"lastAbandonedMode":200}`, Check: func(pd Pdata) bool {
+			return pd.LastAbandonedMode == 200
+		}},
+		{Name: "UnknownEnumName", JSON: `{"lastAbandonedMode":"nope"}`, Error: ErrInvalidEnumValue, Match: "lastAbandonedMode"},
+		{Name: "UnknownEnumNameNested", JSON: `{"activeDailyChallenges":[{},{},{"ref":"nope"},{},{},{},{},{},{}]}`, Error: ErrInvalidEnumValue, Match: "activeDailyChallenges[2].ref"},
+		{Name: "UnknownField", JSON: `{"ranked":{"nope":1}}`, Match: `ranked: unknown field "nope"`},
+		{Name: "ArrayLength", JSON: `{"xp_match":[1,2,3]}`, Error: ErrInvalidSize, Match: "xp_match"},
+		{Name: "Version", JSON: `{"initializedVersion":1}`, Error: ErrUnsupportedVersion},
+		{Name: "ExtraData", JSON: `{"_extraData":"AQID"}`, Check: func(pd Pdata) bool {
+			return string(pd.ExtraData) == "\x01\x02\x03"
+		}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			pd := base
+			err := pd.UnmarshalJSON([]byte(tc.JSON))
+			if tc.Error == nil && tc.Match == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tc.Check != nil && !tc.Check(pd) {
+					t.Errorf("incorrect result")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if tc.Error != nil && !errors.Is(err, tc.Error) {
+				t.Errorf("expected error %v, got %v", tc.Error, err)
+			}
+			if !strings.Contains(err.Error(), tc.Match) {
+				t.Errorf("expected error to contain %q, got %v", tc.Match, err)
+			}
+		})
+	}
+}
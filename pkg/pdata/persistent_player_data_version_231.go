@@ -4,10 +4,11 @@
 //
 // Roundtrip marshal/unmarshal should be byte-identical except for extra data after
 // the null terminator in strings or non-0/1 boolean values. Invalid enum values
-// and trailing data after the pdata root struct are preserved.
+// and trailing data after the pdata root struct are preserved (as base64 in
+// _extraData for JSON).
 package pdata
 
-//go:generate go run github.com/r2northstar/atlas/pkg/pdef/pdefgen 231
+//go:generate go run github.com/r2northstar/atlas/v2/pkg/pdef/pdefgen 231
 
 import (
 	"bytes"
@@ -20,6 +21,7 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -6262,7 +6264,26 @@ func (v Pdata) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *Pdata) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "pdata", Version, err)
+	}
+	if m == nil {
+		return nil
+	}
+	if x, ok := m["_extraData"]; ok {
+		if err := json.Unmarshal(x, &v.ExtraData); err != nil {
+			return fmt.Errorf("decode %q (v%d): field %s: %w", "pdata", Version, "_extraData", err)
+		}
+		delete(m, "_extraData")
+	}
+	if err := pdataUnmarshalJSONStruct(reflect.ValueOf(v).Elem(), m, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "pdata", Version, err)
+	}
+	if x := v.InitializedVersion; x != Version {
+		return fmt.Errorf("decode %q (v%d): %w: got %d", "pdata", Version, ErrUnsupportedVersion, x)
+	}
+	return nil
 }
 func (v Pdata) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6271,7 +6292,24 @@ func (v Pdata) MarshalJSONFilter(filter func(path ...string) bool) ([]byte, erro
 	if x := v.InitializedVersion; x != Version {
 		return nil, fmt.Errorf("encode %q (v%d): %w: got %d", "pdata", Version, ErrUnsupportedVersion, x)
 	}
-	return pdataMarshalJSONStruct(v, filter)
+	b, err := pdataMarshalJSONStruct(v, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.ExtraData) != 0 && (filter == nil || filter("_extraData")) {
+		x, err := json.Marshal(v.ExtraData)
+		if err != nil {
+			return nil, err
+		}
+		b = b[:len(b)-1]
+		if len(b) != 1 {
+			b = append(b, ',')
+		}
+		b = append(b, "\"_extraData\":"...)
+		b = append(b, x...)
+		b = append(b, '}')
+	}
+	return b, nil
 }
 
 type ActiveDailyChallenge struct {
@@ -6299,7 +6337,10 @@ func (v ActiveDailyChallenge) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *ActiveDailyChallenge) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "activeDailyChallenge", Version, err)
+	}
+	return nil
 }
 func (v ActiveDailyChallenge) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6333,7 +6374,10 @@ func (v EChallenge) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *EChallenge) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "eChallenge", Version, err)
+	}
+	return nil
 }
 func (v EChallenge) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6406,7 +6450,10 @@ func (v EFDPostGameData) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *EFDPostGameData) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "eFDPostGameData", Version, err)
+	}
+	return nil
 }
 func (v EFDPostGameData) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6453,7 +6500,10 @@ func (v EFDPostGamePlayer) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *EFDPostGamePlayer) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "eFDPostGamePlayer", Version, err)
+	}
+	return nil
 }
 func (v EFDPostGamePlayer) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6700,7 +6750,10 @@ func (v EPostGameData) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *EPostGameData) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "ePostGameData", Version, err)
+	}
+	return nil
 }
 func (v EPostGameData) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6768,7 +6821,10 @@ func (v EPostGamePlayer) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *EPostGamePlayer) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "ePostGamePlayer", Version, err)
+	}
+	return nil
 }
 func (v EPostGamePlayer) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6882,7 +6938,10 @@ func (v PilotLoadout) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *PilotLoadout) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "pilotLoadout", Version, err)
+	}
+	return nil
 }
 func (v PilotLoadout) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -6983,7 +7042,10 @@ func (v PveData) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *PveData) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "pveData", Version, err)
+	}
+	return nil
 }
 func (v PveData) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7020,7 +7082,10 @@ func (v RecentUnlock) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *RecentUnlock) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "recentUnlock", Version, err)
+	}
+	return nil
 }
 func (v RecentUnlock) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7117,7 +7182,10 @@ func (v DeathStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *DeathStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sDeathStats", Version, err)
+	}
+	return nil
 }
 func (v DeathStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7187,7 +7255,10 @@ func (v FDStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *FDStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sFDStats", Version, err)
+	}
+	return nil
 }
 func (v FDStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7413,7 +7484,10 @@ func (v GameStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *GameStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sGameStats", Version, err)
+	}
+	return nil
 }
 func (v GameStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7477,7 +7551,10 @@ func (v HoursPlayed) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *HoursPlayed) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sHoursPlayed", Version, err)
+	}
+	return nil
 }
 func (v HoursPlayed) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -7790,7 +7867,10 @@ func (v KillStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *KillStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sKillStats", Version, err)
+	}
+	return nil
 }
 func (v KillStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8057,7 +8137,10 @@ func (v MapStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *MapStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sMapStats", Version, err)
+	}
+	return nil
 }
 func (v MapStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8124,7 +8207,10 @@ func (v MilesTraveled) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *MilesTraveled) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sMilesTraveled", Version, err)
+	}
+	return nil
 }
 func (v MilesTraveled) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8281,7 +8367,10 @@ func (v MiscStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *MiscStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sMiscStats", Version, err)
+	}
+	return nil
 }
 func (v MiscStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8358,7 +8447,10 @@ func (v TitanStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *TitanStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sTitanStats", Version, err)
+	}
+	return nil
 }
 func (v TitanStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8446,7 +8538,10 @@ func (v WeaponKillStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *WeaponKillStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sWeaponKillStats", Version, err)
+	}
+	return nil
 }
 func (v WeaponKillStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8495,7 +8590,10 @@ func (v WeaponStats) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *WeaponStats) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "sWeaponStats", Version, err)
+	}
+	return nil
 }
 func (v WeaponStats) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8526,7 +8624,10 @@ func (v SpawnLoadout) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *SpawnLoadout) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "spawnLoadout", Version, err)
+	}
+	return nil
 }
 func (v SpawnLoadout) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8563,7 +8664,10 @@ func (v Struct_activeBurnCardData) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *Struct_activeBurnCardData) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "struct_activeBurnCardData", Version, err)
+	}
+	return nil
 }
 func (v Struct_activeBurnCardData) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8594,7 +8698,10 @@ func (v Struct_blackMarketBurnCardUpgrades) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *Struct_blackMarketBurnCardUpgrades) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "struct_blackMarketBurnCardUpgrades", Version, err)
+	}
+	return nil
 }
 func (v Struct_blackMarketBurnCardUpgrades) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8628,7 +8735,10 @@ func (v Struct_historyBurnCardData) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *Struct_historyBurnCardData) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "struct_historyBurnCardData", Version, err)
+	}
+	return nil
 }
 func (v Struct_historyBurnCardData) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8662,7 +8772,10 @@ func (v Struct_ranked) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *Struct_ranked) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "struct_ranked", Version, err)
+	}
+	return nil
 }
 func (v Struct_ranked) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8758,7 +8871,10 @@ func (v TitanLoadout) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *TitanLoadout) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "titanLoadout", Version, err)
+	}
+	return nil
 }
 func (v TitanLoadout) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -8886,7 +9002,10 @@ func (v TitanMain) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *TitanMain) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "titanMain", Version, err)
+	}
+	return nil
 }
 func (v TitanMain) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -9004,7 +9123,10 @@ func (v WeaponMain) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *WeaponMain) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "weaponMain", Version, err)
+	}
+	return nil
 }
 func (v WeaponMain) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -9050,7 +9172,10 @@ func (v WeaponOffhand) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 func (v *WeaponOffhand) UnmarshalJSON(b []byte) error {
-	return fmt.Errorf("not implemented")
+	if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {
+		return fmt.Errorf("decode %q (v%d): %w", "weaponOffhand", Version, err)
+	}
+	return nil
 }
 func (v WeaponOffhand) MarshalJSON() ([]byte, error) {
 	return v.MarshalJSONFilter(nil)
@@ -9964,7 +10089,10 @@ func (v *BurnCard) UnmarshalJSON(b []byte) error {
 	case "\"bc_vinson_m2\"":
 		*v = BurnCard_bc_vinson_m2
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "BurnCard")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -11963,7 +12091,10 @@ func (v *Challenge) UnmarshalJSON(b []byte) error {
 	case "\"ch_satchel_grunt_kills\"":
 		*v = Challenge_ch_satchel_grunt_kills
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "Challenge")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -12059,7 +12190,10 @@ func (v *Dailychallenge) UnmarshalJSON(b []byte) error {
 	case "\"ch_daily_kills_nuclear_core\"":
 		*v = Dailychallenge_ch_daily_kills_nuclear_core
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "Dailychallenge")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -12188,7 +12322,10 @@ func (v *Faction) UnmarshalJSON(b []byte) error {
 	case "\"faction_marvin\"":
 		*v = Faction_faction_marvin
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "Faction")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -12394,7 +12531,10 @@ func (v *GameModes) UnmarshalJSON(b []byte) error {
 	case "\"fd\"":
 		*v = GameModes_fd
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "GameModes")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -13546,7 +13686,10 @@ func (v *LoadoutWeaponsAndAbilities) UnmarshalJSON(b []byte) error {
 	case "\"melee_titan_punch_vanguard\"":
 		*v = LoadoutWeaponsAndAbilities_melee_titan_punch_vanguard
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "LoadoutWeaponsAndAbilities")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -13873,7 +14016,10 @@ func (v *Maps) UnmarshalJSON(b []byte) error {
 	case "\"mp_rise\"":
 		*v = Maps_mp_rise
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "Maps")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -14024,7 +14170,10 @@ func (v *OwnedEntitlements) UnmarshalJSON(b []byte) error {
 	case "\"ET_DLC7_ARCHER_WARPAINT\"":
 		*v = OwnedEntitlements_ET_DLC7_ARCHER_WARPAINT
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "OwnedEntitlements")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -14219,7 +14368,10 @@ func (v *PilotExecution) UnmarshalJSON(b []byte) error {
 	case "\"execution_ampedwall\"":
 		*v = PilotExecution_execution_ampedwall
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "PilotExecution")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -15140,7 +15292,10 @@ func (v *PilotMod) UnmarshalJSON(b []byte) error {
 	case "\"rocket_arena\"":
 		*v = PilotMod_rocket_arena
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "PilotMod")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -15456,7 +15611,10 @@ func (v *PilotPassive) UnmarshalJSON(b []byte) error {
 	case "\"pas_off_the_grid\"":
 		*v = PilotPassive_pas_off_the_grid
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "PilotPassive")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -15530,7 +15688,10 @@ func (v *PilotRace) UnmarshalJSON(b []byte) error {
 	case "\"race_human_female\"":
 		*v = PilotRace_race_human_female
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "PilotRace")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -15659,7 +15820,10 @@ func (v *PilotSuit) UnmarshalJSON(b []byte) error {
 	case "\"nomad\"":
 		*v = PilotSuit_nomad
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "PilotSuit")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -15788,7 +15952,10 @@ func (v *TitanClasses) UnmarshalJSON(b []byte) error {
 	case "\"vanguard\"":
 		*v = TitanClasses_vanguard
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "TitanClasses")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -16060,7 +16227,10 @@ func (v *TitanExecution) UnmarshalJSON(b []byte) error {
 	case "\"execution_random_6\"":
 		*v = TitanExecution_execution_random_6
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "TitanExecution")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -16134,7 +16304,10 @@ func (v *TitanIsPrimeTitan) UnmarshalJSON(b []byte) error {
 	case "\"titan_is_prime\"":
 		*v = TitanIsPrimeTitan_titan_is_prime
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "TitanIsPrimeTitan")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -16472,7 +16645,10 @@ func (v *TitanMod) UnmarshalJSON(b []byte) error {
 	case "\"stryder_sniper\"":
 		*v = TitanMod_stryder_sniper
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "TitanMod")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -17206,7 +17382,10 @@ func (v *TitanPassive) UnmarshalJSON(b []byte) error {
 	case "\"pas_vanguard_core9\"":
 		*v = TitanPassive_pas_vanguard_core9
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "TitanPassive")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -17489,7 +17668,10 @@ func (v *UnlockRefs) UnmarshalJSON(b []byte) error {
 	case "\"challenges\"":
 		*v = UnlockRefs_challenges
 	default:
-		return json.Unmarshal(b, (*uint8)(v))
+		if len(b) != 0 && b[0] == '"' {
+			return fmt.Errorf("%w: invalid value %s for enum %q", ErrInvalidEnumValue, string(b), "UnlockRefs")
+		}
+		return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers
 	}
 	return nil
 }
@@ -17576,6 +17758,110 @@ func pdataMarshalJSONStruct(obj any, filter func(path ...string) bool, path ...s
 	return b.Bytes(), nil
 }
 
+func pdataUnmarshalJSONStruct(objVal reflect.Value, m map[string]json.RawMessage, path string) error {
+	objTyp := objVal.Type()
+
+	if objTyp.Kind() != reflect.Struct {
+		panic("not a struct")
+	}
+
+	known := make(map[string]struct{}, objTyp.NumField())
+	for i := 0; i < objTyp.NumField(); i++ {
+		fldTyp := objTyp.Field(i)
+
+		fldTag := fldTyp.Tag.Get("pdef")
+		fldTagName, fldTagAttr, _ := strings.Cut(fldTag, ",")
+		if fldTagName == "" {
+			continue
+		}
+		if fldTagAttr != "" {
+			panic(fmt.Errorf("unknown pdef field tag attrs %q", fldTagAttr))
+		}
+		known[fldTagName] = struct{}{}
+
+		fldPath := fldTagName
+		if path != "" {
+			fldPath = path + "." + fldTagName
+		}
+		if raw, ok := m[fldTagName]; ok {
+			if err := pdataUnmarshalJSONValue(objVal.Field(i), raw, fldPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	unknown := make([]string, 0, len(m))
+	for k := range m {
+		if _, ok := known[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		if path != "" {
+			return fmt.Errorf("field %s: unknown field %q", path, unknown[0])
+		}
+		return fmt.Errorf("unknown field %q", unknown[0])
+	}
+	return nil
+}
+
+func pdataUnmarshalJSONValue(val reflect.Value, b []byte, path string) error {
+	switch val.Kind() {
+	case reflect.Struct:
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			if path == "" {
+				return err
+			}
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		return pdataUnmarshalJSONStruct(val, m, path)
+	case reflect.Array:
+		if string(b) == "null" {
+			return nil
+		}
+		var a []json.RawMessage
+		if err := json.Unmarshal(b, &a); err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		if len(a) != val.Len() {
+			return fmt.Errorf("field %s: %w: expected %d elements, got %d", path, ErrInvalidSize, val.Len(), len(a))
+		}
+		for j, x := range a {
+			if err := pdataUnmarshalJSONValue(val.Index(j), x, path+"["+strconv.Itoa(j)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if err := pdataUnmarshalJSONPrimitive(val.Addr().Interface(), b); err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+func pdataUnmarshalJSONPrimitive(v any, b []byte) error {
+	switch v := v.(type) {
+	case *float32:
+		if string(b) == "null" {
+			*v = float32(math.NaN()) // inverse of the marshal behaviour (this loses Inf)
+			return nil
+		}
+		return json.Unmarshal(b, v)
+	case *int32, *bool, *string:
+		return json.Unmarshal(b, v)
+	case json.Unmarshaler:
+		if reflect.TypeOf(v).Elem().ConvertibleTo(reflect.TypeOf(uint8(0))) {
+			return v.UnmarshalJSON(b) // enum
+		}
+		panic(fmt.Errorf("unhandled type %T", v))
+	default:
+		panic(fmt.Errorf("unhandled type %T", v))
+	}
+}
+
 func pdataMarshalJSONPrimitive(v any) ([]byte, error) {
 	switch v := v.(type) {
 	case float32:
@@ -40,10 +40,24 @@ func TestPdataRoundtrip(t *testing.T) {
 				t.Errorf("internal round-trip failed: re-marshaled unmarshaled data encoded by marshal does not match")
 			}
 
-			if buf, err := d2.MarshalJSON(); err != nil {
-				t.Errorf("failed to marshal as JSON: %v", err)
-			} else if err = json.Unmarshal(buf, new(map[string]interface{})); err != nil {
-				t.Errorf("bad json marshal result: %v", err)
+			jbuf, err := d2.MarshalJSON()
+			if err != nil {
+				t.Fatalf("failed to marshal as JSON: %v", err)
+			}
+			if err = json.Unmarshal(jbuf, new(map[string]interface{})); err != nil {
+				t.Fatalf("bad json marshal result: %v", err)
+			}
+
+			var d3 Pdata
+			if err := d3.UnmarshalJSON(jbuf); err != nil {
+				t.Fatalf("failed to unmarshal JSON: %v", err)
+			}
+			jrbuf, err := d3.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal unmarshaled JSON: %v", err)
+			}
+			if !bytes.Equal(rbuf, jrbuf) {
+				t.Errorf("json round-trip failed: re-marshaled data does not match")
 			}
 		})
 	}
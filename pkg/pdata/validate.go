@@ -0,0 +1,82 @@
+package pdata
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError is an error for a specific pdata field.
+type FieldError struct {
+	Path string // e.g., pilotLoadouts[2].primary
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s: %v", e.Path, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateEnums checks that all enum values in v are known. If not, a
+// [*FieldError] wrapping [ErrInvalidEnumValue] is returned for the first
+// invalid value.
+func (v Pdata) ValidateEnums() error {
+	return validateEnums(reflect.ValueOf(v), nil)
+}
+
+func validateEnums(val reflect.Value, path []string) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("pdef"), ",")
+		if name == "" {
+			continue
+		}
+		fldPath := append(path, name)
+
+		fldVal := val.Field(i)
+		if fldVal.Kind() == reflect.Array {
+			for j := 0; j < fldVal.Len(); j++ {
+				elemPath := append(fldPath[:len(fldPath):len(fldPath)], "["+strconv.Itoa(j)+"]")
+				if err := validateEnumValue(fldVal.Index(j), elemPath); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := validateEnumValue(fldVal, fldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateEnumValue(val reflect.Value, path []string) error {
+	switch val.Kind() {
+	case reflect.Struct:
+		return validateEnums(val, path)
+	case reflect.Uint8:
+		if m, ok := val.Interface().(encoding.TextMarshaler); ok {
+			if _, err := m.MarshalText(); err != nil {
+				return &FieldError{Path: joinPath(path), Err: fmt.Errorf("%w: %d", ErrInvalidEnumValue, val.Uint())}
+			}
+		}
+	}
+	return nil
+}
+
+// joinPath formats a field path, where array indexes are separate elements.
+func joinPath(path []string) string {
+	var b strings.Builder
+	for i, x := range path {
+		if i != 0 && !strings.HasPrefix(x, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(x)
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package pdata
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEnums(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Offset int
+		Value  byte
+		Path   string
+	}{
+		{Name: "Valid", Offset: -1},
+		{Name: "Field", Offset: 56159, Value: 0xFF, Path: "lastAbandonedMode"},
+		{Name: "StructArray", Offset: 53535 + 5*2, Value: 0xFF, Path: "activeDailyChallenges[2].ref"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			buf := append([]byte(nil), DefaultPdata...)
+			if tc.Offset >= 0 {
+				buf[tc.Offset] = tc.Value
+			}
+
+			var pd Pdata
+			if err := pd.UnmarshalBinary(buf); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			err := pd.ValidateEnums()
+			if tc.Path == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var ferr *FieldError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("expected field error, got %v", err)
+			}
+			if !errors.Is(err, ErrInvalidEnumValue) {
+				t.Errorf("expected invalid enum value error, got %v", err)
+			}
+			if ferr.Path != tc.Path {
+				t.Errorf("expected path %q, got %q", tc.Path, ferr.Path)
+			}
+		})
+	}
+}
@@ -59,7 +59,8 @@ func main() {
 	pln(&buf, `//`)
 	pln(&buf, `// Roundtrip marshal/unmarshal should be byte-identical except for extra data after`)
 	pln(&buf, `// the null terminator in strings or non-0/1 boolean values. Invalid enum values`)
-	pln(&buf, `// and trailing data after the pdata root struct are preserved.`)
+	pln(&buf, `// and trailing data after the pdata root struct are preserved (as base64 in`)
+	pln(&buf, `// _extraData for JSON).`)
 	pln(&buf, `package pdata`)
 	pln(&buf, ``)
 
@@ -77,6 +78,7 @@ func main() {
 	pln(&buf, `"io"`)
 	pln(&buf, `"math"`)
 	pln(&buf, `"reflect"`)
+	pln(&buf, `"sort"`)
 	pln(&buf, `"strconv"`)
 	pln(&buf, `"strings"`)
 	pln(&buf, `)`)
@@ -256,6 +258,110 @@ func main() {
 			return b.Bytes(), nil
 		}
 
+		func pdataUnmarshalJSONStruct(objVal reflect.Value, m map[string]json.RawMessage, path string) error {
+			objTyp := objVal.Type()
+
+			if objTyp.Kind() != reflect.Struct {
+				panic("not a struct")
+			}
+
+			known := make(map[string]struct{}, objTyp.NumField())
+			for i := 0; i < objTyp.NumField(); i++ {
+				fldTyp := objTyp.Field(i)
+
+				fldTag := fldTyp.Tag.Get("pdef")
+				fldTagName, fldTagAttr, _ := strings.Cut(fldTag, ",")
+				if fldTagName == "" {
+					continue
+				}
+				if fldTagAttr != "" {
+					panic(fmt.Errorf("unknown pdef field tag attrs %q", fldTagAttr))
+				}
+				known[fldTagName] = struct{}{}
+
+				fldPath := fldTagName
+				if path != "" {
+					fldPath = path + "." + fldTagName
+				}
+				if raw, ok := m[fldTagName]; ok {
+					if err := pdataUnmarshalJSONValue(objVal.Field(i), raw, fldPath); err != nil {
+						return err
+					}
+				}
+			}
+
+			unknown := make([]string, 0, len(m))
+			for k := range m {
+				if _, ok := known[k]; !ok {
+					unknown = append(unknown, k)
+				}
+			}
+			if len(unknown) != 0 {
+				sort.Strings(unknown)
+				if path != "" {
+					return fmt.Errorf("field %s: unknown field %q", path, unknown[0])
+				}
+				return fmt.Errorf("unknown field %q", unknown[0])
+			}
+			return nil
+		}
+
+		func pdataUnmarshalJSONValue(val reflect.Value, b []byte, path string) error {
+			switch val.Kind() {
+			case reflect.Struct:
+				var m map[string]json.RawMessage
+				if err := json.Unmarshal(b, &m); err != nil {
+					if path == "" {
+						return err
+					}
+					return fmt.Errorf("field %s: %w", path, err)
+				}
+				return pdataUnmarshalJSONStruct(val, m, path)
+			case reflect.Array:
+				if string(b) == "null" {
+					return nil
+				}
+				var a []json.RawMessage
+				if err := json.Unmarshal(b, &a); err != nil {
+					return fmt.Errorf("field %s: %w", path, err)
+				}
+				if len(a) != val.Len() {
+					return fmt.Errorf("field %s: %w: expected %d elements, got %d", path, ErrInvalidSize, val.Len(), len(a))
+				}
+				for j, x := range a {
+					if err := pdataUnmarshalJSONValue(val.Index(j), x, path+"["+strconv.Itoa(j)+"]"); err != nil {
+						return err
+					}
+				}
+				return nil
+			default:
+				if err := pdataUnmarshalJSONPrimitive(val.Addr().Interface(), b); err != nil {
+					return fmt.Errorf("field %s: %w", path, err)
+				}
+				return nil
+			}
+		}
+
+		func pdataUnmarshalJSONPrimitive(v any, b []byte) error {
+			switch v := v.(type) {
+			case *float32:
+				if string(b) == "null" {
+					*v = float32(math.NaN()) // inverse of the marshal behaviour (this loses Inf)
+					return nil
+				}
+				return json.Unmarshal(b, v)
+			case *int32, *bool, *string:
+				return json.Unmarshal(b, v)
+			case json.Unmarshaler:
+				if reflect.TypeOf(v).Elem().ConvertibleTo(reflect.TypeOf(uint8(0))) {
+					return v.UnmarshalJSON(b) // enum
+				}
+				panic(fmt.Errorf("unhandled type %T", v))
+			default:
+				panic(fmt.Errorf("unhandled type %T", v))
+			}
+		}
+
 		func pdataMarshalJSONPrimitive(v any) ([]byte, error) {
 			switch v := v.(type) {
 			case float32:
@@ -331,10 +437,24 @@ func main() {
 							t.Errorf("internal round-trip failed: re-marshaled unmarshaled data encoded by marshal does not match")
 						}
 
-						if buf, err := d2.MarshalJSON(); err != nil {
-							t.Errorf("failed to marshal as JSON: %%v", err)
-						} else if err = json.Unmarshal(buf, new(map[string]interface{})); err != nil {
-							t.Errorf("bad json marshal result: %%v", err)
+						jbuf, err := d2.MarshalJSON()
+						if err != nil {
+							t.Fatalf("failed to marshal as JSON: %%v", err)
+						}
+						if err = json.Unmarshal(jbuf, new(map[string]interface{})); err != nil {
+							t.Fatalf("bad json marshal result: %%v", err)
+						}
+
+						var d3 Pdata
+						if err := d3.UnmarshalJSON(jbuf); err != nil {
+							t.Fatalf("failed to unmarshal JSON: %%v", err)
+						}
+						jrbuf, err := d3.MarshalBinary()
+						if err != nil {
+							t.Fatalf("failed to marshal unmarshaled JSON: %%v", err)
+						}
+						if !bytes.Equal(rbuf, jrbuf) {
+							t.Errorf("json round-trip failed: re-marshaled data does not match")
 						}
 					})
 				}
@@ -552,8 +672,33 @@ func generateStruct(buf *bytes.Buffer, name string, pd *pdef.Pdef, fields []pdef
 	}
 	{
 		pln(buf, `func (v *%s) UnmarshalJSON(b []byte) error {`, mangle(name, true))
-		// TODO: implement this if we actually have a use for it
-		pln(buf, `return fmt.Errorf("not implemented")`)
+		if root {
+			pln(buf, `var m map[string]json.RawMessage`)
+			pln(buf, `if err := json.Unmarshal(b, &m); err != nil {`)
+			pln(buf, `return fmt.Errorf(%#v, %#v, Version, err)`, `decode %q (v%d): %w`, name)
+			pln(buf, `}`)
+			pln(buf, `if m == nil {`)
+			pln(buf, `return nil`)
+			pln(buf, `}`)
+			pln(buf, `if x, ok := m[%#v]; ok {`, "_"+mangle("extraData", false))
+			pln(buf, `if err := json.Unmarshal(x, &v.%s); err != nil {`, mangle("extraData", true))
+			pln(buf, `return fmt.Errorf(%#v, %#v, Version, %#v, err)`, `decode %q (v%d): field %s: %w`, name, "_"+mangle("extraData", false))
+			pln(buf, `}`)
+			pln(buf, `delete(m, %#v)`, "_"+mangle("extraData", false))
+			pln(buf, `}`)
+			pln(buf, `if err := pdataUnmarshalJSONStruct(reflect.ValueOf(v).Elem(), m, ""); err != nil {`)
+			pln(buf, `return fmt.Errorf(%#v, %#v, Version, err)`, `decode %q (v%d): %w`, name)
+			pln(buf, `}`)
+			pln(buf, `if x := v.%s; x != Version {`, mangle(fields[0].Name, true))
+			pln(buf, `return fmt.Errorf(%#v, %#v, Version, ErrUnsupportedVersion, x)`, `decode %q (v%d): %w: got %d`, name)
+			pln(buf, `}`)
+			pln(buf, `return nil`)
+		} else {
+			pln(buf, `if err := pdataUnmarshalJSONValue(reflect.ValueOf(v).Elem(), b, ""); err != nil {`)
+			pln(buf, `return fmt.Errorf(%#v, %#v, Version, err)`, `decode %q (v%d): %w`, name)
+			pln(buf, `}`)
+			pln(buf, `return nil`)
+		}
 		pln(buf, `}`)
 	}
 	{
@@ -567,8 +712,27 @@ func generateStruct(buf *bytes.Buffer, name string, pd *pdef.Pdef, fields []pdef
 			pln(buf, `if x := v.%s; x != Version {`, mangle(fields[0].Name, true))
 			pln(buf, `return nil, fmt.Errorf(%#v, %#v, Version, ErrUnsupportedVersion, x)`, `encode %q (v%d): %w: got %d`, name)
 			pln(buf, `}`)
+			pln(buf, `b, err := pdataMarshalJSONStruct(v, filter)`)
+			pln(buf, `if err != nil {`)
+			pln(buf, `return nil, err`)
+			pln(buf, `}`)
+			pln(buf, `if len(v.%s) != 0 && (filter == nil || filter(%#v)) {`, mangle("extraData", true), "_"+mangle("extraData", false))
+			pln(buf, `x, err := json.Marshal(v.%s)`, mangle("extraData", true))
+			pln(buf, `if err != nil {`)
+			pln(buf, `return nil, err`)
+			pln(buf, `}`)
+			pln(buf, `b = b[:len(b)-1]`)
+			pln(buf, `if len(b) != 1 {`)
+			pln(buf, `b = append(b, ',')`)
+			pln(buf, `}`)
+			pln(buf, `b = append(b, %#v...)`, `"_`+mangle("extraData", false)+`":`)
+			pln(buf, `b = append(b, x...)`)
+			pln(buf, `b = append(b, '}')`)
+			pln(buf, `}`)
+			pln(buf, `return b, nil`)
+		} else {
+			pln(buf, `return pdataMarshalJSONStruct(v, filter)`)
 		}
-		pln(buf, `return pdataMarshalJSONStruct(v, filter)`)
 		pln(buf, `}`)
 	}
 }
@@ -655,7 +819,10 @@ func generateEnum(buf *bytes.Buffer, name string, values []string) {
 			pln(buf, `*v = %s`, mangleEnumValue(name, v))
 		}
 		pln(buf, `default:`)
-		pln(buf, `return json.Unmarshal(b, (*uint8)(v))`)
+		pln(buf, `if len(b) != 0 && b[0] == '"' {`)
+		pln(buf, `return fmt.Errorf(%#v, ErrInvalidEnumValue, string(b), %#v)`, "%w: invalid value %s for enum %q", mangle(name, true))
+		pln(buf, `}`)
+		pln(buf, `return json.Unmarshal(b, (*uint8)(v)) // unknown values are preserved as numbers`)
 		pln(buf, `}`)
 		pln(buf, `return nil`)
 		pln(buf, `}`)
@@ -0,0 +1,97 @@
+// Package stryder verifies Origin tokens using Respawn's Stryder API.
+package stryder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NucleusAuthURL is the Stryder endpoint used to verify Origin tokens.
+const NucleusAuthURL = "https://r2-pc.stryder.respawn.com/nucleus-oauth.php"
+
+var (
+	ErrInvalidToken          = errors.New("invalid token")
+	ErrMultiplayerNotAllowed = errors.New("multiplayer not allowed")
+	ErrUnavailable           = errors.New("stryder unavailable")
+)
+
+// NucleusAuth verifies that token was issued by Origin for uid. If c is nil,
+// [net/http.DefaultClient] is used.
+func NucleusAuth(ctx context.Context, c *http.Client, token string, uid uint64) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, NucleusAuthURL+"?"+(url.Values{
+		"qt":         {"origin-requesttoken"},
+		"type":       {"server_token"},
+		"code":       {token},
+		"forceTrial": {"0"},
+		"proto":      {"0"},
+		"json":       {"1"},
+		"env":        {"production"},
+		"userId":     {strings.ToUpper(strconv.FormatUint(uid, 16))},
+	}).Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Respawn HTTPS/1.0")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: response status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: read response: %v", ErrUnavailable, err)
+	}
+	return nucleusAuth(buf)
+}
+
+func nucleusAuth(buf []byte) error {
+	var obj struct {
+		Success         bool   `json:"success"`
+		Status          string `json:"status"`
+		Error           string `json:"error"`
+		HasOnlineAccess string `json:"hasOnlineAccess"`
+	}
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return fmt.Errorf("%w: decode response: %v", ErrUnavailable, err)
+	}
+	if obj.Success {
+		if obj.HasOnlineAccess != "1" {
+			return ErrMultiplayerNotAllowed
+		}
+		return nil
+	}
+	switch obj.Status {
+	case "400", "401", "403":
+		if obj.Error != "" {
+			// the error is usually a json object from the oauth server, so
+			// extract the description if possible
+			var e struct {
+				Error            string `json:"error"`
+				ErrorDescription string `json:"error_description"`
+			}
+			if json.Unmarshal([]byte(obj.Error), &e) == nil && e.ErrorDescription != "" {
+				return fmt.Errorf("%w: %s", ErrInvalidToken, e.ErrorDescription)
+			}
+			return fmt.Errorf("%w: %s", ErrInvalidToken, obj.Error)
+		}
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("%w: unexpected response status %q (error: %q)", ErrUnavailable, obj.Status, obj.Error)
+}
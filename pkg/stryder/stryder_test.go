@@ -0,0 +1,72 @@
+package stryder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// stubTransport sends all requests to a test server.
+type stubTransport struct {
+	URL string
+}
+
+func (t stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNucleusAuth(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Status int
+		Body   string
+		Err    error
+	}{
+		{"OK", 200, `{"success":true,"status":"200","hasOnlineAccess":"1"}`, nil},
+		{"NoOnlineAccess", 200, `{"success":true,"status":"200","hasOnlineAccess":"0"}`, ErrMultiplayerNotAllowed},
+		{"InvalidToken", 200, `{"success":false,"status":"400","error":"{\"error\":\"invalid_grant\",\"error_description\":\"code is invalid\"}"}`, ErrInvalidToken},
+		{"InvalidTokenRawError", 200, `{"success":false,"status":"401","error":"bad token"}`, ErrInvalidToken},
+		{"Forbidden", 200, `{"success":false,"status":"403"}`, ErrInvalidToken},
+		{"UnexpectedStatus", 200, `{"success":false,"status":"503","error":"down"}`, ErrUnavailable},
+		{"ServerError", 502, `bad gateway`, ErrUnavailable},
+		{"InvalidJSON", 200, `<html>`, ErrUnavailable},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if q := r.URL.Query(); q.Get("code") != "token" || q.Get("userId") != "1A2B" {
+					t.Errorf("unexpected query %q", r.URL.RawQuery)
+				}
+				w.WriteHeader(tc.Status)
+				w.Write([]byte(tc.Body))
+			}))
+			defer srv.Close()
+
+			err := NucleusAuth(context.Background(), &http.Client{Transport: stubTransport{srv.URL}}, "token", 0x1a2b)
+			if tc.Err == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.Err != nil && !errors.Is(err, tc.Err) {
+				t.Errorf("expected error %q, got %v", tc.Err, err)
+			}
+		})
+	}
+
+	t.Run("Unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		err := NucleusAuth(context.Background(), &http.Client{Transport: stubTransport{srv.URL}}, "token", 1)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected error %q, got %v", ErrUnavailable, err)
+		}
+	})
+}